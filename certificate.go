@@ -1,7 +1,49 @@
 package keygen
 
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	licenseFileLabel = "LICENSE FILE"
+	machineFileLabel = "MACHINE FILE"
+)
+
+// armorPattern matches a certificate's armor, capturing its begin label, its
+// payload and its end label.
+var armorPattern = regexp.MustCompile(`-----BEGIN ([A-Z ]+)-----([^-]*)-----END ([A-Z ]+)-----`)
+
 type certificate struct {
 	Enc string `json:"enc"`
 	Sig string `json:"sig"`
 	Alg string `json:"alg"`
 }
+
+// unarmor returns the base64 payload of a certificate, removing its armor and
+// any whitespace, e.g. line wrapping and CRLF line endings. Certificates
+// without armor are assumed to be a raw payload.
+func unarmor(cert string, label string) (string, error) {
+	payload := cert
+
+	if strings.Contains(cert, "-----") {
+		m := armorPattern.FindStringSubmatch(cert)
+		switch {
+		case m == nil || m[1] != m[3]:
+			return "", &ArmorError{Expected: label}
+		case m[1] != label:
+			return "", &ArmorError{Expected: label, Actual: m[1]}
+		}
+
+		payload = m[2]
+	}
+
+	return strings.Join(strings.Fields(payload), ""), nil
+}
+
+// armor normalizes a certificate's line endings and trailing newline.
+func armor(cert string) string {
+	cert = strings.ReplaceAll(cert, "\r\n", "\n")
+
+	return strings.TrimSpace(cert) + "\n"
+}
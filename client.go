@@ -9,7 +9,6 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/go-querystring/query"
@@ -18,9 +17,6 @@ import (
 
 var (
 	userAgent = "keygen/" + APIVersion + " sdk/" + SDKVersion + " go/" + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH
-
-	// mutex is used to sychronize access to the HTTP client.
-	mutex = &sync.Mutex{}
 )
 
 type Response struct {
@@ -59,14 +55,15 @@ type ClientOptions struct {
 	APIVersion  string
 	APIPrefix   string
 	APIURL      string
+	Retry       *RetryPolicy
+	Clock       Clock
 }
 
 // Client represents the internal HTTP client and config used for API requests.
+// A Client is safe for concurrent use by multiple goroutines.
 type Client struct {
 	HTTPClient *http.Client
 	ClientOptions
-
-	mutex *sync.Mutex
 }
 
 // NewClient creates a new Client with default settings.
@@ -83,8 +80,9 @@ func NewClient() *Client {
 			APIPrefix:   APIPrefix,
 			APIVersion:  APIVersion,
 			APIURL:      APIURL,
+			Retry:       Retry,
+			Clock:       DefaultClock,
 		},
-		mutex,
 	}
 
 	return client
@@ -104,8 +102,9 @@ func NewClientWithOptions(options *ClientOptions) *Client {
 			APIPrefix:   options.APIPrefix,
 			APIVersion:  options.APIVersion,
 			APIURL:      options.APIURL,
+			Retry:       options.Retry,
+			Clock:       options.Clock,
 		},
-		mutex,
 	}
 
 	return client
@@ -164,22 +163,24 @@ func (c *Client) Delete(ctx context.Context, path string, params interface{}, mo
 func (c *Client) new(ctx context.Context, method string, path string, params interface{}) (*http.Request, error) {
 	var url string
 
-	if c.APIVersion == "" {
-		c.APIVersion = APIVersion
-	}
+	// Local vars so we don't mutate the client, which may be in use by
+	// other goroutines
+	account := c.Account
+	version := c.APIVersion
+	prefix := c.APIPrefix
+	host := c.APIURL
 
-	if c.APIPrefix == "" {
-		c.APIPrefix = APIPrefix
+	if version == "" {
+		version = APIVersion
 	}
 
-	if c.APIURL == "" {
-		c.APIURL = APIURL
+	if prefix == "" {
+		prefix = APIPrefix
 	}
 
-	// Local vars so we don't mutate the client
-	account := c.Account
-	prefix := c.APIPrefix
-	host := c.APIURL
+	if host == "" {
+		host = APIURL
+	}
 
 	// Add scheme if not present (e.g. with self-hosted KEYGEN_HOST env var via the CLI)
 	if !strings.HasPrefix(host, "https://") && !strings.HasPrefix(host, "http://") {
@@ -252,7 +253,7 @@ func (c *Client) new(ctx context.Context, method string, path string, params int
 		req.Header.Add("Keygen-Environment", c.Environment)
 	}
 
-	req.Header.Add("Keygen-Version", c.APIVersion)
+	req.Header.Add("Keygen-Version", version)
 
 	if in.Len() > 0 {
 		req.Header.Add("Content-Type", jsonapi.ContentType)
@@ -265,12 +266,43 @@ func (c *Client) new(ctx context.Context, method string, path string, params int
 }
 
 func (c *Client) send(req *http.Request, model interface{}) (*Response, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	attempts := c.Retry.attempts()
+
+	for attempt := 1; ; attempt++ {
+		res, err := c.do(req, model)
+		if err == nil || attempt >= attempts || !c.Retry.retryable(req, res, err) {
+			return res, err
+		}
+
+		backoff := c.Retry.backoff(attempt, res, c.clock().Now())
+
+		Logger.Warnf("Retrying request: method=%s url=%s attempt=%d backoff=%s err=%v", req.Method, req.URL, attempt, backoff, err)
+
+		timer := c.clock().NewTimer(backoff)
+
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+
+			return res, req.Context().Err()
+		case <-timer.C():
+		}
+
+		req, err = rewind(req)
+		if err != nil {
+			return res, err
+		}
+	}
+}
 
-	c.HTTPClient.CheckRedirect = c.checkRedirect
+func (c *Client) do(req *http.Request, model interface{}) (*Response, error) {
+	// Use a shallow copy of the HTTP client so that we don't mutate a client
+	// that may be shared with other goroutines. The underlying transport,
+	// and its connection pool, is still shared.
+	httpClient := *c.HTTPClient
+	httpClient.CheckRedirect = c.checkRedirect
 
-	res, err := c.HTTPClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		Logger.Errorf("Error performing request: method=%s url=%s err=%v", req.Method, req.URL, err)
 
@@ -341,11 +373,11 @@ func (c *Client) send(req *http.Request, model interface{}) (*Response, error) {
 	case response.Status >= http.StatusInternalServerError:
 		Logger.Errorf("An unexpected API error occurred: id=%s status=%d size=%d body=%s", response.ID, response.Status, response.Size, response.tldr())
 
-		return response, fmt.Errorf("an error occurred: id=%s status=%d size=%d body=%s", response.ID, response.Status, response.Size, response.tldr())
+		return response, &Error{response, "", "", "", ""}
 	}
 
 	if c.PublicKey != "" {
-		verifier := &verifier{c.PublicKey}
+		verifier := &verifier{PublicKey: c.PublicKey, Clock: c.clock()}
 
 		if err := verifier.VerifyResponse(response); err != nil {
 			Logger.Errorf("Error verifying response signature: id=%s status=%d size=%d body=%s err=%v", response.ID, response.Status, response.Size, response.tldr(), err)
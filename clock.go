@@ -0,0 +1,89 @@
+package keygen
+
+import (
+	"time"
+)
+
+// Clock provides the current time and timers used by the SDK's time-based
+// checks, e.g. clock drift and expiry checks, heartbeat and watcher timing,
+// and retry backoff. Implement it to use a trusted time source, or to use a
+// fake clock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a Timer that fires once after the duration.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a Clock's timer. It behaves like a time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after the duration. It should only be
+	// called on stopped or fired timers with drained channels.
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is a Clock using the system time.
+type SystemClock struct{}
+
+// Now implements the Clock interface.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer implements the Clock interface.
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t *systemTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// clock returns the config's clock, or the package-level DefaultClock when
+// the config or its clock is nil.
+func (c *Config) clock() Clock {
+	if c != nil && c.Clock != nil {
+		return c.Clock
+	}
+
+	return defaultClock()
+}
+
+// clock returns the client's clock, or the package-level DefaultClock when
+// the client's clock is nil.
+func (c *Client) clock() Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+
+	return defaultClock()
+}
+
+// defaultClock returns DefaultClock, or the system clock when it's nil.
+func defaultClock() Clock {
+	if DefaultClock != nil {
+		return DefaultClock
+	}
+
+	return SystemClock{}
+}
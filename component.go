@@ -109,3 +109,32 @@ type Components []Component
 func (c *Components) SetData(to func(target interface{}) error) error {
 	return to(c)
 }
+
+// ComponentIterator iterates over a paginated list of components, requesting
+// additional pages as needed.
+type ComponentIterator struct {
+	iterator
+	components Components
+}
+
+// Next advances the iterator to the next component. It returns false when there
+// are no more components or when an error occurs. Check Err after iterating.
+func (it *ComponentIterator) Next() bool {
+	return it.next(func() (bool, int, error) {
+		it.components = Components{}
+
+		ok, err := it.pager.fetch(it.ctx, &it.components)
+
+		return ok, len(it.components), err
+	})
+}
+
+// Component returns the current component.
+func (it *ComponentIterator) Component() *Component {
+	return &it.components[it.index]
+}
+
+// Err returns the error, if any, that occurred during iteration.
+func (it *ComponentIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,117 @@
+package keygen
+
+import (
+	"io/fs"
+	"os"
+)
+
+// ComponentCollector discovers hardware components from the root filesystem.
+// Collectors return components using the raw hardware identifier as their
+// Fingerprint, which CollectComponents then hashes. Missing hardware should
+// result in no components rather than an error.
+type ComponentCollector func(fsys fs.FS) (Components, error)
+
+// DefaultComponentCollectors are the collectors used by CollectComponents by
+// default. The built-in collectors are only supported on Linux, and return
+// no components on other platforms.
+var DefaultComponentCollectors = []ComponentCollector{
+	CollectCPUs,
+	CollectDisks,
+	CollectNetworkInterfaces,
+	CollectMotherboard,
+}
+
+type ComponentOptions struct {
+	// Collectors are the collectors used to discover components. Defaults to
+	// DefaultComponentCollectors.
+	Collectors []ComponentCollector
+
+	// FS is the root filesystem that hardware is discovered from. Defaults
+	// to the OS's root filesystem.
+	FS fs.FS
+}
+
+type ComponentOption func(*ComponentOptions) error
+
+// ComponentCollectors sets the collectors used to discover components.
+func ComponentCollectors(collectors ...ComponentCollector) ComponentOption {
+	return func(options *ComponentOptions) error {
+		options.Collectors = collectors
+
+		return nil
+	}
+}
+
+// ComponentFS sets the root filesystem that hardware is discovered from, e.g.
+// a fstest.MapFS for tests.
+func ComponentFS(fsys fs.FS) ComponentOption {
+	return func(options *ComponentOptions) error {
+		options.FS = fsys
+
+		return nil
+	}
+}
+
+// CollectComponents discovers the current machine's hardware components, for
+// use with License.Activate and component-scoped validation. Fingerprints are
+// an HMAC-SHA256 of each component's hardware identifier keyed by the current
+// Product, so that they're specific to your app. Duplicate components are
+// removed.
+func CollectComponents(options ...ComponentOption) (Components, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.CollectComponents(options...)
+}
+
+// CollectComponents discovers the current machine's hardware components, keyed
+// by the config's Product. See the package-level CollectComponents.
+func (c *Config) CollectComponents(options ...ComponentOption) (Components, error) {
+	product := c.resolve().Product
+	if product == "" {
+		return nil, ErrFingerprintProductMissing
+	}
+
+	opts := ComponentOptions{Collectors: DefaultComponentCollectors}
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.FS == nil {
+		opts.FS = os.DirFS("/")
+	}
+
+	components := Components{}
+	seen := map[string]bool{}
+
+	for _, collect := range opts.Collectors {
+		collected, err := collect(opts.FS)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, component := range collected {
+			component.Fingerprint = protectIdentifier(product, component.Fingerprint)
+			if seen[component.Fingerprint] {
+				continue
+			}
+
+			seen[component.Fingerprint] = true
+			components = append(components, component)
+		}
+	}
+
+	return components, nil
+}
+
+// Fingerprints returns the fingerprints of the components, e.g. for use as the
+// component fingerprints of a license validation.
+func (c Components) Fingerprints() []string {
+	fingerprints := make([]string, 0, len(c))
+	for _, component := range c {
+		fingerprints = append(fingerprints, component.Fingerprint)
+	}
+
+	return fingerprints
+}
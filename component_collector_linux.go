@@ -0,0 +1,220 @@
+package keygen
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	// virtualBlockDevicePrefixes are block devices which aren't backed by
+	// physical hardware.
+	virtualBlockDevicePrefixes = []string{"loop", "ram", "zram", "dm-", "md", "nbd", "sr", "fd"}
+
+	// placeholderIdentifiers are values some vendors ship in place of an
+	// actual serial number.
+	placeholderIdentifiers = []string{"", "none", "n/a", "default string", "to be filled by o.e.m.", "not specified", "not applicable", "system serial number", "0", "00000000"}
+)
+
+// CollectCPUs discovers the machine's CPUs from /proc/cpuinfo, one component
+// per physical CPU package.
+func CollectCPUs(fsys fs.FS) (Components, error) {
+	b, err := fs.ReadFile(fsys, "proc/cpuinfo")
+	if err != nil {
+		return nil, nil
+	}
+
+	components := Components{}
+	packages := map[string]string{}
+	var model, pkg string
+
+	flush := func() {
+		if model != "" {
+			if _, ok := packages[pkg]; !ok {
+				packages[pkg] = model
+			}
+		}
+
+		model, pkg = "", ""
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		switch k {
+		case "model name", "Hardware", "cpu model":
+			model = v
+		case "physical id":
+			pkg = v
+		}
+	}
+
+	flush()
+
+	for _, pkg := range sortedKeys(packages) {
+		model := packages[pkg]
+
+		components = append(components, Component{
+			Fingerprint: "cpu:" + pkg + ":" + model,
+			Name:        model,
+		})
+	}
+
+	return components, nil
+}
+
+// CollectDisks discovers the machine's physical disks from /sys/block, using
+// each disk's WWID or serial number.
+func CollectDisks(fsys fs.FS) (Components, error) {
+	entries, err := fs.ReadDir(fsys, "sys/block")
+	if err != nil {
+		return nil, nil
+	}
+
+	components := Components{}
+
+	for _, entry := range entries {
+		dev := entry.Name()
+		if isVirtualBlockDevice(dev) {
+			continue
+		}
+
+		dir := path.Join("sys/block", dev)
+		id := ""
+
+		for _, name := range []string{"wwid", "device/wwid", "device/serial", "serial"} {
+			if v, err := readIdentifier(fsys, path.Join(dir, name)); err == nil && !isPlaceholderIdentifier(v) {
+				id = v
+
+				break
+			}
+		}
+
+		if id == "" {
+			continue
+		}
+
+		name := dev
+		if model, err := readIdentifier(fsys, path.Join(dir, "device/model")); err == nil {
+			name = model
+		}
+
+		components = append(components, Component{
+			Fingerprint: "disk:" + id,
+			Name:        name,
+		})
+	}
+
+	return components, nil
+}
+
+// CollectNetworkInterfaces discovers the machine's physical network interfaces
+// from /sys/class/net, using each interface's MAC address. Virtual interfaces,
+// e.g. loopback, bridges and veths, are ignored.
+func CollectNetworkInterfaces(fsys fs.FS) (Components, error) {
+	entries, err := fs.ReadDir(fsys, "sys/class/net")
+	if err != nil {
+		return nil, nil
+	}
+
+	components := Components{}
+
+	for _, entry := range entries {
+		iface := entry.Name()
+		dir := path.Join("sys/class/net", iface)
+
+		// Only physical interfaces are backed by a device
+		if _, err := fs.Stat(fsys, path.Join(dir, "device")); err != nil {
+			continue
+		}
+
+		mac, err := readIdentifier(fsys, path.Join(dir, "address"))
+		if err != nil || mac == "00:00:00:00:00:00" {
+			continue
+		}
+
+		components = append(components, Component{
+			Fingerprint: "net:" + strings.ToLower(mac),
+			Name:        iface,
+		})
+	}
+
+	return components, nil
+}
+
+// CollectMotherboard discovers the machine's motherboard from DMI, using its
+// serial number. Reading the serial number usually requires root privileges.
+func CollectMotherboard(fsys fs.FS) (Components, error) {
+	serial, err := readIdentifier(fsys, "sys/class/dmi/id/board_serial")
+	if err != nil || isPlaceholderIdentifier(serial) {
+		return nil, nil
+	}
+
+	var names []string
+	for _, name := range []string{"board_vendor", "board_name"} {
+		if v, err := readIdentifier(fsys, "sys/class/dmi/id/"+name); err == nil {
+			names = append(names, v)
+		}
+	}
+
+	name := strings.Join(names, " ")
+	if name == "" {
+		name = "motherboard"
+	}
+
+	return Components{
+		{
+			Fingerprint: "board:" + serial,
+			Name:        name,
+		},
+	}, nil
+}
+
+func isVirtualBlockDevice(dev string) bool {
+	for _, prefix := range virtualBlockDevicePrefixes {
+		if strings.HasPrefix(dev, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPlaceholderIdentifier(id string) bool {
+	id = strings.ToLower(strings.TrimSpace(id))
+
+	for _, placeholder := range placeholderIdentifiers {
+		if id == placeholder {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
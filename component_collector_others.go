@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package keygen
+
+import "io/fs"
+
+// CollectCPUs is only supported on Linux.
+func CollectCPUs(fsys fs.FS) (Components, error) { return nil, nil }
+
+// CollectDisks is only supported on Linux.
+func CollectDisks(fsys fs.FS) (Components, error) { return nil, nil }
+
+// CollectNetworkInterfaces is only supported on Linux.
+func CollectNetworkInterfaces(fsys fs.FS) (Components, error) { return nil, nil }
+
+// CollectMotherboard is only supported on Linux.
+func CollectMotherboard(fsys fs.FS) (Components, error) { return nil, nil }
@@ -0,0 +1,243 @@
+package keygen
+
+import (
+	"context"
+	"net/http"
+)
+
+// Config represents an instance-scoped SDK configuration, allowing a single
+// program to work with multiple Keygen accounts, products or licensees. Its
+// methods mirror the package-level API, and resources returned from those
+// methods, e.g. a License or Machine, carry the Config with them.
+//
+// A nil *Config uses the package-level globals, which act as the default
+// configuration.
+type Config struct {
+	// APIURL is the URL of the API service backend.
+	APIURL string
+
+	// APIVersion is the API version used for requests.
+	APIVersion string
+
+	// APIPrefix is the major version prefix included in all API URLs.
+	APIPrefix string
+
+	// Account is the Keygen account identifier.
+	Account string
+
+	// Product is the Keygen product identifier.
+	Product string
+
+	// Package is the Keygen package identifier.
+	Package string
+
+	// Environment is the Keygen environment identifier.
+	Environment string
+
+	// LicenseKey is the end-user's license key.
+	LicenseKey string
+
+	// Token is the end-user's API token.
+	Token string
+
+	// PublicKey is the Keygen public key used for verifying license keys,
+	// license files and API response signatures.
+	PublicKey string
+
+	// RSAPublicKey is the Keygen RSA public key used for verifying license
+	// keys and license files signed using RSA.
+	RSAPublicKey string
+
+	// UserAgent is appended to the user-agent string sent to the API.
+	UserAgent string
+
+	// HTTPClient is the HTTP client used for API requests. Defaults to the
+	// package-level HTTPClient when nil.
+	HTTPClient *http.Client
+
+	// Retry is the retry policy used for API requests.
+	Retry *RetryPolicy
+
+	// Clock is the clock used for time-based checks. Defaults to the
+	// package-level DefaultClock when nil.
+	Clock Clock
+}
+
+// NewConfig creates a new Config, using the current package-level globals as
+// defaults. Fields can then be overridden as needed.
+func NewConfig() *Config {
+	return &Config{
+		APIURL:       APIURL,
+		APIVersion:   APIVersion,
+		APIPrefix:    APIPrefix,
+		Account:      Account,
+		Product:      Product,
+		Package:      Package,
+		Environment:  Environment,
+		LicenseKey:   LicenseKey,
+		Token:        Token,
+		PublicKey:    PublicKey,
+		RSAPublicKey: RSAPublicKey,
+		UserAgent:    UserAgent,
+		HTTPClient:   HTTPClient,
+		Retry:        Retry,
+		Clock:        DefaultClock,
+	}
+}
+
+// NewClient creates a new Client using the config's settings.
+func (c *Config) NewClient() *Client {
+	if c == nil {
+		return NewClient()
+	}
+
+	client := NewClientWithOptions(&ClientOptions{
+		Account:     c.Account,
+		Environment: c.Environment,
+		LicenseKey:  c.LicenseKey,
+		Token:       c.Token,
+		PublicKey:   c.PublicKey,
+		UserAgent:   c.UserAgent,
+		APIPrefix:   c.APIPrefix,
+		APIVersion:  c.APIVersion,
+		APIURL:      c.APIURL,
+		Retry:       c.Retry,
+		Clock:       c.Clock,
+	})
+
+	if c.HTTPClient != nil {
+		client.HTTPClient = c.HTTPClient
+	}
+
+	return client
+}
+
+// Validate performs a license validation using the config's LicenseKey or Token.
+// See the package-level Validate.
+func (c *Config) Validate(ctx context.Context, fingerprints ...string) (*License, error) {
+	return c.ValidateWithOptions(ctx, ValidationOptions{}, fingerprints...)
+}
+
+// ValidateWithOptions performs a license validation using the config's LicenseKey
+// or Token, scoped to the options. See the package-level ValidateWithOptions.
+func (c *Config) ValidateWithOptions(ctx context.Context, options ValidationOptions, fingerprints ...string) (*License, error) {
+	client := c.NewClient()
+	license := &License{config: c}
+
+	if _, err := client.Get(ctx, "me", nil, license); err != nil {
+		return nil, err
+	}
+
+	if err := license.ValidateWithOptions(ctx, options, fingerprints...); err != nil {
+		return license, err
+	}
+
+	return license, nil
+}
+
+// ValidateKey performs a license validation using the config's LicenseKey, without
+// authenticating the request. See the package-level ValidateKey.
+func (c *Config) ValidateKey(ctx context.Context, options ValidationOptions, fingerprints ...string) (*License, error) {
+	cfg := c.resolve()
+	if cfg.LicenseKey == "" {
+		return nil, ErrLicenseKeyMissing
+	}
+
+	// The key is sent in the request body instead of being used to authenticate
+	client := c.NewClient()
+	client.LicenseKey = ""
+	client.Token = ""
+
+	params, err := newValidate(cfg, options, fingerprints...)
+	if err != nil {
+		return nil, err
+	}
+
+	params.key = cfg.LicenseKey
+	validation := &validation{}
+
+	res, err := client.Post(ctx, "licenses/actions/validate-key", params, validation)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := params.verify(validation.Result); err != nil {
+		return nil, err
+	}
+
+	validation.Result.Source = ValidationSourceNetwork
+	validation.Result.Timestamp = signedDate(client, res)
+
+	// The license is null when the key isn't found
+	if validation.License.ID == "" {
+		return nil, validationError(validation.Result.Code)
+	}
+
+	license := &validation.License
+	license.config = c
+	license.LastValidation = &validation.Result
+
+	return license, validationError(validation.Result.Code)
+}
+
+// Upgrade checks if an upgrade is available for the provided version using the
+// config's settings. See the package-level Upgrade.
+func (c *Config) Upgrade(ctx context.Context, options UpgradeOptions) (*Release, error) {
+	cfg := c.resolve()
+
+	if options.PublicKey == cfg.PublicKey {
+		panic("You MUST use a personal public key. This MUST NOT be your Keygen account's public key.")
+	}
+
+	if options.Filename == "" {
+		options.Filename = `{{.program}}_{{.platform}}_{{.arch}}{{if .ext}}.{{.ext}}{{end}}`
+	}
+
+	if options.Product == "" {
+		options.Product = cfg.Product
+	}
+
+	if options.Package == "" {
+		options.Package = cfg.Package
+	}
+
+	if options.Channel == "" {
+		options.Channel = "stable"
+	}
+
+	client := c.NewClient()
+	params := querystring{Product: options.Product, Package: options.Package, Constraint: options.Constraint, Channel: options.Channel}
+	release := &Release{}
+
+	if _, err := client.Get(ctx, "releases/"+options.CurrentVersion+"/upgrade", params, release); err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			return nil, ErrUpgradeNotAvailable
+		default:
+			return nil, err
+		}
+	}
+
+	release.opts = options
+	release.config = c
+
+	return release, nil
+}
+
+// VerifyWebhook verifies the signature of a webhook request sent from Keygen
+// using the config's PublicKey. See the package-level VerifyWebhook.
+func (c *Config) VerifyWebhook(request *http.Request) error {
+	verifier := &verifier{PublicKey: c.resolve().PublicKey, Clock: c.clock()}
+
+	return verifier.VerifyRequest(request)
+}
+
+// resolve returns the config, or a snapshot of the package-level globals
+// when the config is nil.
+func (c *Config) resolve() *Config {
+	if c == nil {
+		return NewConfig()
+	}
+
+	return c
+}
@@ -5,9 +5,14 @@ import (
 	"crypto/cipher"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"strings"
 )
 
+// errDecryptionFailed is returned when a certificate's ciphertext can't be
+// authenticated, e.g. when it's decrypted using the wrong secret.
+var errDecryptionFailed = errors.New("cipher: message authentication failed")
+
 type decryptor struct {
 	Secret string
 }
@@ -54,7 +59,7 @@ func (d *decryptor) DecryptCertificate(cert *certificate) ([]byte, error) {
 	// Decrypt
 	plaintext, err := aes.Open(nil, iv, ciphertext, nil)
 	if err != nil {
-		return nil, err
+		return nil, errDecryptionFailed
 	}
 
 	return plaintext, nil
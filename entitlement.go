@@ -38,3 +38,64 @@ type Entitlements []Entitlement
 func (e *Entitlements) SetData(to func(target interface{}) error) error {
 	return to(e)
 }
+
+// Has reports whether one of the entitlements has the code.
+func (e Entitlements) Has(code EntitlementCode) bool {
+	return len(e.missing(code)) == 0
+}
+
+// Require checks that every code belongs to one of the entitlements. It returns
+// an EntitlementsMissingError listing any missing codes.
+func (e Entitlements) Require(codes ...EntitlementCode) error {
+	if missing := e.missing(codes...); len(missing) > 0 {
+		return &EntitlementsMissingError{Missing: missing}
+	}
+
+	return nil
+}
+
+// missing returns the codes that don't belong to any of the entitlements.
+func (e Entitlements) missing(codes ...EntitlementCode) []EntitlementCode {
+	entitled := map[EntitlementCode]bool{}
+	for _, entitlement := range e {
+		entitled[entitlement.Code] = true
+	}
+
+	var missing []EntitlementCode
+	for _, code := range codes {
+		if !entitled[code] {
+			missing = append(missing, code)
+		}
+	}
+
+	return missing
+}
+
+// EntitlementIterator iterates over a paginated list of entitlements, requesting
+// additional pages as needed.
+type EntitlementIterator struct {
+	iterator
+	entitlements Entitlements
+}
+
+// Next advances the iterator to the next entitlement. It returns false when there
+// are no more entitlements or when an error occurs. Check Err after iterating.
+func (it *EntitlementIterator) Next() bool {
+	return it.next(func() (bool, int, error) {
+		it.entitlements = Entitlements{}
+
+		ok, err := it.pager.fetch(it.ctx, &it.entitlements)
+
+		return ok, len(it.entitlements), err
+	})
+}
+
+// Entitlement returns the current entitlement.
+func (it *EntitlementIterator) Entitlement() *Entitlement {
+	return &it.entitlements[it.index]
+}
+
+// Err returns the error, if any, that occurred during iteration.
+func (it *EntitlementIterator) Err() error {
+	return it.err
+}
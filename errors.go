@@ -3,6 +3,7 @@ package keygen
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -87,6 +88,38 @@ type MachineFileError struct{ Err error }
 func (e *MachineFileError) Error() string { return "machine file is invalid" }
 func (e *MachineFileError) Unwrap() error { return e.Err }
 
+// ArmorError represents a certificate with malformed or unexpected armor, e.g. a
+// machine file being parsed as a license file.
+type ArmorError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ArmorError) Error() string {
+	if e.Actual == "" {
+		return "certificate armor is malformed"
+	}
+
+	return "certificate is a " + strings.ToLower(e.Actual) + " (expected a " + strings.ToLower(e.Expected) + ")"
+}
+
+// EntitlementsMissingError represents a license missing one or more required
+// entitlements. It wraps ErrLicenseEntitlementsMissing.
+type EntitlementsMissingError struct {
+	Missing []EntitlementCode
+}
+
+func (e *EntitlementsMissingError) Error() string {
+	codes := make([]string, len(e.Missing))
+	for i, code := range e.Missing {
+		codes[i] = string(code)
+	}
+
+	return "license is missing entitlements: " + strings.Join(codes, ", ")
+}
+
+func (e *EntitlementsMissingError) Unwrap() error { return ErrLicenseEntitlementsMissing }
+
 // RateLimitError represents an API rate limiting error.
 type RateLimitError struct {
 	Window     string
@@ -101,6 +134,19 @@ type RateLimitError struct {
 func (e *RateLimitError) Error() string { return "rate limit has been exceeded" }
 func (e *RateLimitError) Unwrap() error { return e.Err }
 
+// ValidationCodeError represents a validation error for a specific validation code.
+// It wraps the more general error for the code, e.g. ErrLicenseNotActivated.
+type ValidationCodeError struct {
+	Code ValidationCode
+	Err  error
+}
+
+func (e *ValidationCodeError) Error() string {
+	return e.Err.Error() + " (" + strings.ToLower(string(e.Code)) + ")"
+}
+
+func (e *ValidationCodeError) Unwrap() error { return e.Err }
+
 // General errors
 var (
 	ErrReleaseLocationMissing       = errors.New("release has no download URL")
@@ -124,9 +170,15 @@ var (
 	ErrValidationFingerprintMissing = errors.New("validation fingerprint scope is missing")
 	ErrValidationComponentsMissing  = errors.New("validation components scope is missing")
 	ErrValidationProductMissing     = errors.New("validation product scope is missing")
+	ErrValidationFileMissing        = errors.New("validation license or machine file is missing")
+	ErrValidationStoreMissing       = errors.New("validation store is missing")
+	ErrValidationNonceMismatch      = errors.New("validation nonce does not match")
+	ErrStoredFileNotFound           = errors.New("stored file was not found")
+	ErrStoredFileInvalid            = errors.New("stored file is invalid")
 	ErrHeartbeatPingFailed          = errors.New("heartbeat ping failed")
 	ErrHeartbeatRequired            = errors.New("heartbeat is required")
 	ErrHeartbeatDead                = errors.New("heartbeat is dead")
+	ErrHeartbeatExpired             = errors.New("heartbeat window has passed without a successful ping")
 	ErrMachineAlreadyActivated      = errors.New("machine is already activated")
 	ErrMachineLimitExceeded         = errors.New("machine limit has been exceeded")
 	ErrMachineNotFound              = errors.New("machine no longer exists")
@@ -135,6 +187,7 @@ var (
 	ErrMachineFileNotEncrypted      = errors.New("machine file is not encrypted")
 	ErrMachineFileNotGenuine        = errors.New("machine file is not genuine")
 	ErrMachineFileExpired           = errors.New("machine file is expired")
+	ErrMachineFileEncrypted         = errors.New("machine file is encrypted")
 	ErrComponentNotActivated        = errors.New("component is not activated")
 	ErrComponentAlreadyActivated    = errors.New("component is already activated")
 	ErrComponentConflict            = errors.New("component is duplicated")
@@ -143,6 +196,7 @@ var (
 	ErrLicenseSchemeMissing         = errors.New("license scheme is missing")
 	ErrLicenseKeyMissing            = errors.New("license key is missing")
 	ErrLicenseKeyNotGenuine         = errors.New("license key is not genuine")
+	ErrLicenseKeyDatasetInvalid     = errors.New("license key dataset is invalid")
 	ErrLicenseNotActivated          = errors.New("license is not activated")
 	ErrLicenseNotAllowed            = errors.New("license authentication is not allowed by policy")
 	ErrLicenseExpired               = errors.New("license is expired")
@@ -156,10 +210,36 @@ var (
 	ErrLicenseFileNotEncrypted      = errors.New("license file is not encrypted")
 	ErrLicenseFileNotGenuine        = errors.New("license file is not genuine")
 	ErrLicenseFileExpired           = errors.New("license file is expired")
+	ErrLicenseFileEncrypted         = errors.New("license file is encrypted")
 	ErrLicenseFileSecretMissing     = errors.New("license file secret is missing")
 	ErrTokenNotAllowed              = errors.New("token authentication is not allowed by policy")
 	ErrTokenFormatInvalid           = errors.New("token format is invalid")
 	ErrTokenInvalid                 = errors.New("token is invalid")
 	ErrTokenExpired                 = errors.New("token is expired")
 	ErrSystemClockUnsynced          = errors.New("system clock is out of sync")
+	ErrFingerprintNotAvailable      = errors.New("machine fingerprint is not available")
+	ErrFingerprintNotSupported      = errors.New("machine fingerprint strategy is not supported")
+	ErrFingerprintProductMissing    = errors.New("machine fingerprint product is missing")
+)
+
+// Validation errors, for validation codes that share a general error, returned
+// by ValidationResult.Err. Use errors.Is to check for the general error, e.g.
+// ErrLicenseNotActivated.
+var (
+	ErrLicenseNotFound             = &ValidationCodeError{ValidationCodeNotFound, ErrLicenseInvalid}
+	ErrLicenseBanned               = &ValidationCodeError{ValidationCodeBanned, ErrLicenseInvalid}
+	ErrLicenseOverdue              = &ValidationCodeError{ValidationCodeOverdue, ErrLicenseInvalid}
+	ErrLicenseNoMachines           = &ValidationCodeError{ValidationCodeNoMachines, ErrLicenseNotActivated}
+	ErrFingerprintNotActivated     = &ValidationCodeError{ValidationCodeFingerprintScopeMismatch, ErrLicenseNotActivated}
+	ErrValidationFingerprintEmpty  = &ValidationCodeError{ValidationCodeFingerprintScopeEmpty, ErrValidationFingerprintMissing}
+	ErrValidationComponentsEmpty   = &ValidationCodeError{ValidationCodeComponentsScopeEmpty, ErrValidationComponentsMissing}
+	ErrValidationProductMismatch   = &ValidationCodeError{ValidationCodeProductScopeMismatch, ErrValidationProductMissing}
+	ErrValidationPolicyMissing     = &ValidationCodeError{ValidationCodePolicyScopeRequired, ErrLicenseInvalid}
+	ErrValidationPolicyMismatch    = &ValidationCodeError{ValidationCodePolicyScopeMismatch, ErrLicenseInvalid}
+	ErrValidationMachineMissing    = &ValidationCodeError{ValidationCodeMachineScopeRequired, ErrLicenseInvalid}
+	ErrValidationMachineMismatch   = &ValidationCodeError{ValidationCodeMachineScopeMismatch, ErrLicenseInvalid}
+	ErrValidationUserMissing       = &ValidationCodeError{ValidationCodeUserScopeRequired, ErrLicenseInvalid}
+	ErrValidationUserMismatch      = &ValidationCodeError{ValidationCodeUserScopeMismatch, ErrLicenseInvalid}
+	ErrValidationEntitlementsEmpty = &ValidationCodeError{ValidationCodeEntitlementsEmpty, ErrLicenseInvalid}
+	ErrLicenseEntitlementsMissing  = &ValidationCodeError{ValidationCodeEntitlementsMissing, ErrLicenseInvalid}
 )
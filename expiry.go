@@ -0,0 +1,130 @@
+package keygen
+
+import (
+	"errors"
+	"time"
+)
+
+type ExpiryStatus string
+
+const (
+	// ExpiryStatusActive indicates the license doesn't expire, or doesn't expire
+	// within the policy's warning period.
+	ExpiryStatusActive ExpiryStatus = "ACTIVE"
+
+	// ExpiryStatusExpiring indicates the license expires within the policy's
+	// warning period.
+	ExpiryStatusExpiring ExpiryStatus = "EXPIRING"
+
+	// ExpiryStatusInGrace indicates the license has expired, but is within the
+	// policy's grace period.
+	ExpiryStatusInGrace ExpiryStatus = "IN_GRACE"
+
+	// ExpiryStatusExpired indicates the license has expired, and its grace
+	// period, if any, has passed.
+	ExpiryStatusExpired ExpiryStatus = "EXPIRED"
+)
+
+// ExpiryPolicy classifies a license's expiry, e.g. to show an "expires in N
+// days" warning before expiry, and to allow a grace period after expiry. The
+// zero value has no warning or grace period.
+type ExpiryPolicy struct {
+	// WarningPeriod is how long before expiry a license is expiring.
+	WarningPeriod time.Duration
+
+	// GracePeriod is how long after expiry a license is still usable.
+	GracePeriod time.Duration
+}
+
+// Expiration is the classification of a license's expiry by an ExpiryPolicy.
+type Expiration struct {
+	Status ExpiryStatus
+
+	// Expiry is the license's expiry, or nil if the license doesn't expire.
+	Expiry *time.Time
+
+	// Remaining is the time until expiry, or until the grace period ends when
+	// in grace. It's zero when expired or when the license doesn't expire.
+	Remaining time.Duration
+}
+
+// Days returns the remaining time in days, rounded up, e.g. for an "expires in
+// N days" warning.
+func (e Expiration) Days() int {
+	const day = 24 * time.Hour
+
+	return int((e.Remaining + day - 1) / day)
+}
+
+// Classify classifies an expiry, e.g. a license's Expiry, using the DefaultClock.
+func (p ExpiryPolicy) Classify(expiry *time.Time) Expiration {
+	return p.classify(expiry, defaultClock().Now())
+}
+
+// Apply classifies a validated license's expiry, and applies the policy to the
+// validation's error. When the license is in grace, ErrLicenseExpired is
+// replaced with nil, and other errors are returned as-is. It can be used with
+// both online and offline validations, e.g. Validate or ValidateOffline. The
+// current time is the validation's signed Timestamp when available, so that
+// the system clock can't extend the grace period, or else the license's config
+// clock. When the API considers the license expired but its Expiry hasn't
+// passed, e.g. it has no expiry, there's no grace period and the error is
+// returned as-is.
+//
+// Example:
+//
+//	license, err := keygen.Validate(ctx, fingerprint)
+//	expiration, err := policy.Apply(license, err)
+//	switch {
+//	case err != nil:
+//		panic(err)
+//	case expiration.Status == keygen.ExpiryStatusExpiring:
+//		fmt.Printf("License expires in %d days\n", expiration.Days())
+//	case expiration.Status == keygen.ExpiryStatusInGrace:
+//		fmt.Printf("License has expired, renew within %d days\n", expiration.Days())
+//	}
+func (p ExpiryPolicy) Apply(license *License, err error) (Expiration, error) {
+	if license == nil {
+		return Expiration{}, err
+	}
+
+	now := license.config.clock().Now()
+	if result := license.LastValidation; result != nil && !result.Timestamp.IsZero() {
+		now = result.Timestamp
+	}
+
+	expiration := p.classify(license.Expiry, now)
+
+	if !errors.Is(err, ErrLicenseExpired) {
+		return expiration, err
+	}
+
+	switch expiration.Status {
+	case ExpiryStatusInGrace:
+		return expiration, nil
+	case ExpiryStatusActive, ExpiryStatusExpiring:
+		// There's no expiry to anchor a grace period to
+		expiration = Expiration{Status: ExpiryStatusExpired, Expiry: license.Expiry}
+	}
+
+	return expiration, err
+}
+
+func (p ExpiryPolicy) classify(expiry *time.Time, now time.Time) Expiration {
+	if expiry == nil {
+		return Expiration{Status: ExpiryStatusActive}
+	}
+
+	remaining := expiry.Sub(now)
+
+	switch {
+	case remaining > p.WarningPeriod:
+		return Expiration{Status: ExpiryStatusActive, Expiry: expiry, Remaining: remaining}
+	case remaining > 0:
+		return Expiration{Status: ExpiryStatusExpiring, Expiry: expiry, Remaining: remaining}
+	case remaining+p.GracePeriod > 0:
+		return Expiration{Status: ExpiryStatusInGrace, Expiry: expiry, Remaining: remaining + p.GracePeriod}
+	default:
+		return Expiration{Status: ExpiryStatusExpired, Expiry: expiry}
+	}
+}
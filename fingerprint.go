@@ -0,0 +1,140 @@
+package keygen
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// FingerprintStrategy defines a source of a machine's identity, used to
+// derive a machine fingerprint.
+type FingerprintStrategy string
+
+const (
+	// FingerprintStrategyContainer uses the current container's ID. It's only
+	// available when running inside a container, e.g. Docker or Kubernetes,
+	// where the host's machine ID is often shared by every container. Since a
+	// container's ID changes whenever it's recreated, it's not a default
+	// strategy and must be opted into using FingerprintStrategies.
+	FingerprintStrategyContainer FingerprintStrategy = "CONTAINER"
+
+	// FingerprintStrategyMachineID uses the OS installation's machine ID, e.g.
+	// /etc/machine-id on Linux.
+	FingerprintStrategyMachineID FingerprintStrategy = "MACHINE_ID"
+
+	// FingerprintStrategyProductUUID uses the DMI product UUID of the machine's
+	// motherboard. On Linux, this usually requires root privileges.
+	FingerprintStrategyProductUUID FingerprintStrategy = "PRODUCT_UUID"
+)
+
+// DefaultFingerprintStrategies is the default fallback order of strategies used
+// when generating a machine fingerprint. The first available strategy is used.
+var DefaultFingerprintStrategies = []FingerprintStrategy{
+	FingerprintStrategyMachineID,
+	FingerprintStrategyProductUUID,
+}
+
+type FingerprintOptions struct {
+	// Strategies is the fallback order of strategies. Defaults to
+	// DefaultFingerprintStrategies.
+	Strategies []FingerprintStrategy
+
+	// FS is the root filesystem that machine identifiers are read from.
+	// Defaults to the OS's root filesystem. Only used on Linux.
+	FS fs.FS
+}
+
+type FingerprintOption func(*FingerprintOptions) error
+
+// FingerprintStrategies sets the fallback order of strategies used when
+// generating a machine fingerprint.
+func FingerprintStrategies(strategies ...FingerprintStrategy) FingerprintOption {
+	return func(options *FingerprintOptions) error {
+		options.Strategies = strategies
+
+		return nil
+	}
+}
+
+// FingerprintFS sets the root filesystem that machine identifiers are read
+// from, e.g. a fstest.MapFS for tests.
+func FingerprintFS(fsys fs.FS) FingerprintOption {
+	return func(options *FingerprintOptions) error {
+		options.FS = fsys
+
+		return nil
+	}
+}
+
+// Fingerprint generates a stable fingerprint for the current machine, using the
+// first available strategy. The machine's identifier is never sent as-is: the
+// fingerprint is an HMAC-SHA256 of the identifier keyed by the current Product,
+// so that it's specific to your app. An error will be returned if no strategy
+// is available, e.g. ErrFingerprintNotAvailable.
+func Fingerprint(options ...FingerprintOption) (string, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.Fingerprint(options...)
+}
+
+// Fingerprint generates a stable fingerprint for the current machine, keyed by
+// the config's Product. See the package-level Fingerprint.
+func (c *Config) Fingerprint(options ...FingerprintOption) (string, error) {
+	product := c.resolve().Product
+	if product == "" {
+		return "", ErrFingerprintProductMissing
+	}
+
+	opts := FingerprintOptions{Strategies: DefaultFingerprintStrategies}
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.FS == nil {
+		opts.FS = os.DirFS("/")
+	}
+
+	for _, strategy := range opts.Strategies {
+		id, err := machineIdentifier(opts.FS, strategy)
+		if err != nil {
+			Logger.Debugf("Fingerprint strategy is not available: strategy=%s err=%v", strategy, err)
+
+			continue
+		}
+
+		Logger.Debugf("Fingerprint strategy is available: strategy=%s", strategy)
+
+		return protectIdentifier(product, id), nil
+	}
+
+	return "", ErrFingerprintNotAvailable
+}
+
+// protectIdentifier derives an app-specific fingerprint from a machine
+// identifier, so that the raw identifier is never disclosed.
+func protectIdentifier(key string, id string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(id))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readIdentifier reads a trimmed identifier from a file.
+func readIdentifier(fsys fs.FS, name string) (string, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	id := strings.TrimSpace(string(b))
+	if id == "" {
+		return "", ErrFingerprintNotAvailable
+	}
+
+	return id, nil
+}
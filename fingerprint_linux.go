@@ -0,0 +1,109 @@
+package keygen
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+var (
+	// containerIDPattern matches a 64-char container ID, e.g. a Docker or
+	// containerd ID, within a cgroup path or mount.
+	containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+	// containerCgroupHints are found in PID 1's cgroups when running inside a
+	// container under cgroup v1.
+	containerCgroupHints = []string{"docker", "kubepods", "containerd", "lxc", "libpod"}
+)
+
+func machineIdentifier(fsys fs.FS, strategy FingerprintStrategy) (string, error) {
+	switch strategy {
+	case FingerprintStrategyContainer:
+		return containerIdentifier(fsys)
+	case FingerprintStrategyMachineID:
+		// Fallback to the D-Bus machine ID for older distros
+		for _, name := range []string{"etc/machine-id", "var/lib/dbus/machine-id"} {
+			if id, err := readIdentifier(fsys, name); err == nil && id != "uninitialized" {
+				return id, nil
+			}
+		}
+
+		return "", ErrFingerprintNotAvailable
+	case FingerprintStrategyProductUUID:
+		id, err := readIdentifier(fsys, "sys/class/dmi/id/product_uuid")
+		if err != nil {
+			return "", err
+		}
+
+		// Some vendors ship placeholder UUIDs, e.g. all zeros or all Fs, which
+		// are shared by every machine and useless for fingerprinting.
+		if isPlaceholderUUID(id) {
+			return "", ErrFingerprintNotAvailable
+		}
+
+		return strings.ToLower(id), nil
+	default:
+		return "", ErrFingerprintNotSupported
+	}
+}
+
+func containerIdentifier(fsys fs.FS) (string, error) {
+	if !inContainer(fsys) {
+		return "", ErrFingerprintNotAvailable
+	}
+
+	// cgroup v1 includes the container ID in the cgroup path, while cgroup v2
+	// usually only exposes it via the container's mounts, e.g. /etc/hostname.
+	for _, name := range []string{"proc/self/cgroup", "proc/self/mountinfo"} {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			continue
+		}
+
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			line := s.Text()
+			if name == "proc/self/mountinfo" && !strings.Contains(line, "/containers/") {
+				continue
+			}
+
+			if id := containerIDPattern.FindString(line); id != "" {
+				return id, nil
+			}
+		}
+	}
+
+	return "", ErrFingerprintNotAvailable
+}
+
+func inContainer(fsys fs.FS) bool {
+	for _, name := range []string{".dockerenv", "run/.containerenv"} {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			return true
+		}
+	}
+
+	b, err := fs.ReadFile(fsys, "proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+
+	for _, hint := range containerCgroupHints {
+		if bytes.Contains(b, []byte(hint)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPlaceholderUUID(id string) bool {
+	hex := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if hex == "" {
+		return true
+	}
+
+	return strings.Count(hex, hex[:1]) == len(hex) || hex == "03000200040005000006000700080009"
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package keygen
+
+import (
+	"io/fs"
+
+	"github.com/denisbrodbeck/machineid"
+)
+
+// machineIdentifier only supports the OS installation's machine ID outside of
+// Linux, e.g. the MachineGuid on Windows or the IOPlatformUUID on macOS.
+func machineIdentifier(fsys fs.FS, strategy FingerprintStrategy) (string, error) {
+	switch strategy {
+	case FingerprintStrategyMachineID:
+		return machineid.ID()
+	case FingerprintStrategyContainer, FingerprintStrategyProductUUID:
+		return "", ErrFingerprintNotAvailable
+	default:
+		return "", ErrFingerprintNotSupported
+	}
+}
@@ -0,0 +1,228 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// heartbeatLeeway is subtracted from the heartbeat window when scheduling
+	// pings, to account for any network lag.
+	heartbeatLeeway = 30 * time.Second
+
+	// heartbeatDefaultWindow is used when the resource has no heartbeat window,
+	// matching the API's default.
+	heartbeatDefaultWindow = 10 * time.Minute
+
+	heartbeatMinBackoff = time.Second
+	heartbeatMaxBackoff = 30 * time.Second
+)
+
+// Heartbeat sends heartbeat pings for a machine or process on a loop, until
+// its context is cancelled or the server reports the heartbeat as dead.
+// Failed pings are retried within the remaining heartbeat window, unless
+// retrying can't help, e.g. when the license is suspended or the token is
+// revoked. A Heartbeat is safe for concurrent use by multiple goroutines.
+type Heartbeat struct {
+	ping     func(ctx context.Context) error
+	clock    Clock
+	window   time.Duration
+	interval time.Duration
+	errs     chan error
+	done     chan struct{}
+	mu       sync.RWMutex
+	lastPing time.Time
+	err      error
+}
+
+func newHeartbeat(ping func(ctx context.Context) error, window time.Duration, clock Clock) *Heartbeat {
+	if window <= 0 {
+		window = heartbeatDefaultWindow
+	}
+
+	interval := window - heartbeatLeeway
+	if interval <= 0 {
+		interval = window / 2
+	}
+
+	return &Heartbeat{
+		ping:     ping,
+		clock:    clock,
+		window:   window,
+		interval: interval,
+		errs:     make(chan error, 16),
+		done:     make(chan struct{}),
+	}
+}
+
+// Errors returns a channel where ping errors are emitted. Errors are dropped
+// when the channel's buffer is full. The channel is closed once the heartbeat
+// stops.
+func (h *Heartbeat) Errors() <-chan error {
+	return h.errs
+}
+
+// Done returns a channel that's closed once the heartbeat stops.
+func (h *Heartbeat) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error that stopped the heartbeat, e.g. ErrHeartbeatDead or
+// ErrHeartbeatExpired, or the context's error if it was cancelled. Returns nil
+// while the heartbeat is running.
+func (h *Heartbeat) Err() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.err
+}
+
+// LastPing returns the time of the last successful heartbeat ping.
+func (h *Heartbeat) LastPing() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.lastPing
+}
+
+// start starts the heartbeat loop, after a successful first ping.
+func (h *Heartbeat) start(ctx context.Context) {
+	h.touch()
+
+	go h.run(ctx)
+}
+
+func (h *Heartbeat) run(ctx context.Context) {
+	timer := h.clock.NewTimer(h.interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.stop(ctx.Err())
+
+			return
+		case <-timer.C():
+		}
+
+		if err := h.beat(ctx); err != nil {
+			h.stop(err)
+
+			return
+		}
+
+		timer.Reset(h.interval)
+	}
+}
+
+// beat sends a ping, retrying failed pings with backoff. It only returns an
+// error when the heartbeat should stop, i.e. when the context is done, the
+// error can't be fixed by retrying, or the heartbeat window has passed.
+func (h *Heartbeat) beat(ctx context.Context) error {
+	backoff := heartbeatMinBackoff
+
+	for {
+		err := h.ping(ctx)
+		switch {
+		case err == nil:
+			h.touch()
+
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case isHeartbeatTerminal(err):
+			h.emit(err)
+
+			return err
+		}
+
+		Logger.Warnf("Heartbeat ping failed: err=%v", err)
+
+		h.emit(fmt.Errorf("%w: %v", ErrHeartbeatPingFailed, err))
+
+		// Once the heartbeat window has passed, the server will consider the
+		// heartbeat dead, so there's no point in retrying.
+		if deadline := h.LastPing().Add(h.window); h.clock.Now().After(deadline) {
+			Logger.Errorf("Heartbeat window has passed without a successful ping: last=%s window=%s", h.LastPing(), h.window)
+
+			h.emit(ErrHeartbeatExpired)
+
+			return ErrHeartbeatExpired
+		}
+
+		timer := h.clock.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C():
+		}
+
+		if backoff *= 2; backoff > heartbeatMaxBackoff {
+			backoff = heartbeatMaxBackoff
+		}
+	}
+}
+
+func (h *Heartbeat) touch() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastPing = h.clock.Now()
+}
+
+func (h *Heartbeat) emit(err error) {
+	select {
+	case h.errs <- err:
+	default:
+		Logger.Warnf("Heartbeat error dropped: err=%v", err)
+	}
+}
+
+func (h *Heartbeat) stop(err error) {
+	h.mu.Lock()
+	h.err = err
+	h.mu.Unlock()
+
+	close(h.errs)
+	close(h.done)
+}
+
+// isHeartbeatTerminal reports whether err should stop a heartbeat, i.e. when
+// the heartbeat is dead or the request was rejected, e.g. due to a suspended
+// license or an invalid token, since retrying won't change the outcome.
+func isHeartbeatTerminal(err error) bool {
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		return false
+	}
+
+	var e *Error
+	if errors.As(err, &e) && e.Response != nil {
+		status := e.Response.Status
+
+		return status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusRequestTimeout
+	}
+
+	switch {
+	case errors.Is(err, ErrHeartbeatDead),
+		errors.Is(err, ErrMachineNotFound),
+		errors.Is(err, ErrProcessNotFound),
+		errors.Is(err, ErrLicenseSuspended),
+		errors.Is(err, ErrLicenseExpired),
+		errors.Is(err, ErrLicenseNotAllowed),
+		errors.Is(err, ErrTokenInvalid),
+		errors.Is(err, ErrTokenExpired),
+		errors.Is(err, ErrTokenFormatInvalid),
+		errors.Is(err, ErrTokenNotAllowed):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,178 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+type ValidationSource string
+
+const (
+	// ValidationSourceNetwork indicates the validation was performed by the API.
+	ValidationSourceNetwork ValidationSource = "NETWORK"
+
+	// ValidationSourceCache indicates the validation was performed offline using
+	// license or machine files, e.g. files cached by a previous checkout.
+	ValidationSourceCache ValidationSource = "CACHE"
+)
+
+// HybridOptions contains the options for a hybrid online/offline validation.
+type HybridOptions struct {
+	// Store persists the files checked out after each successful online
+	// validation, and provides them when the API is unreachable. Required.
+	// When the store implements LastSeenStore, e.g. a FileStore, it's also
+	// used to detect the system clock being rolled back, and the latest time
+	// seen is advanced using the API's signed response dates.
+	Store Store
+
+	// GracePeriod is how long after being issued cached files may be used
+	// when the API is unreachable. Zero means cached files may be used until
+	// their TTL expires.
+	GracePeriod time.Duration
+
+	// CheckoutOptions are used when checking out license and machine files.
+	CheckoutOptions []CheckoutOption
+
+	// Nonce, when true, validates using a nonce. See ValidationOptions.Nonce.
+	// Only the API's time from a nonce-verified response can move the latest
+	// time seen backwards, e.g. after the system clock was ahead.
+	Nonce bool
+}
+
+// ValidateHybrid performs a license validation using the current Token, scoped
+// to any provided fingerprints, falling back to offline validation when the API
+// is unreachable.
+//
+// After a successful online validation, a license file, and a machine file when
+// a fingerprint is provided, are checked out and saved to the store. When the API
+// can't be reached due to a network error, or is unavailable due to a server error,
+// the cached files are validated offline instead, within the grace period. The
+// license's LastValidation.Source reports whether the result came from the network
+// or from the cache. When the API is unreachable and there are no cached files, or
+// no LicenseKey to decrypt them, the network error is returned.
+func ValidateHybrid(ctx context.Context, options HybridOptions, fingerprints ...string) (*License, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.ValidateHybrid(ctx, options, fingerprints...)
+}
+
+// ValidateHybrid performs a hybrid online/offline validation using the config's
+// settings. See the package-level ValidateHybrid.
+func (c *Config) ValidateHybrid(ctx context.Context, options HybridOptions, fingerprints ...string) (*License, error) {
+	if options.Store == nil {
+		return nil, ErrValidationStoreMissing
+	}
+
+	cfg := c.resolve()
+	lastSeen, _ := options.Store.(LastSeenStore)
+
+	license, err := c.ValidateWithOptions(ctx, ValidationOptions{Nonce: options.Nonce}, fingerprints...)
+
+	// Advance the last seen time using the API's signed time, even when the
+	// license is invalid, or using the system time when responses aren't signed
+	if license != nil && license.LastValidation != nil && lastSeen != nil && cfg.LicenseKey != "" {
+		t, trust := license.LastValidation.Timestamp, lastSeenSigned
+		switch {
+		case t.IsZero():
+			t, trust = c.clock().Now(), lastSeenUntrusted
+		case options.Nonce:
+			trust = lastSeenVerified
+		}
+
+		if e := advanceLastSeen(lastSeen, cfg.LicenseKey, t, trust); e != nil {
+			Logger.Warnf("Error storing last seen time: license_id=%s err=%v", license.ID, e)
+		}
+	}
+
+	switch {
+	case err == nil:
+		c.checkoutFiles(ctx, license, options, fingerprints...)
+
+		return license, nil
+	case !isNetworkError(err):
+		return license, err
+	}
+
+	Logger.Warnf("API is unreachable, validating offline using cached files: err=%v", err)
+
+	offline := OfflineOptions{MaxAge: options.GracePeriod, LastSeen: lastSeen}
+
+	if lic, e := options.Store.LoadLicenseFile(); e == nil {
+		offline.LicenseFile = lic
+	}
+
+	if len(fingerprints) > 0 {
+		if mf, e := options.Store.LoadMachineFile(); e == nil {
+			offline.MachineFile = mf
+		}
+	}
+
+	// Cached files can't be decrypted without a license key, e.g. when using a
+	// token, so there's no fallback
+	if cfg.LicenseKey == "" || offline.LicenseFile == nil && offline.MachineFile == nil {
+		return nil, err
+	}
+
+	return c.ValidateOffline(offline, fingerprints...)
+}
+
+// checkoutFiles checks out and stores fresh files for a valid license. Failures
+// are logged rather than returned, since the license has already been validated.
+func (c *Config) checkoutFiles(ctx context.Context, license *License, options HybridOptions, fingerprints ...string) {
+	lic, err := license.Checkout(ctx, options.CheckoutOptions...)
+	if err != nil {
+		Logger.Warnf("Error checking out license file: license_id=%s err=%v", license.ID, err)
+
+		return
+	}
+
+	if err := options.Store.SaveLicenseFile(lic); err != nil {
+		Logger.Warnf("Error storing license file: license_id=%s err=%v", license.ID, err)
+	}
+
+	if len(fingerprints) == 0 {
+		return
+	}
+
+	machine, err := license.Machine(ctx, fingerprints[0])
+	if err != nil {
+		Logger.Warnf("Error retrieving machine: license_id=%s err=%v", license.ID, err)
+
+		return
+	}
+
+	mf, err := machine.Checkout(ctx, options.CheckoutOptions...)
+	if err != nil {
+		Logger.Warnf("Error checking out machine file: machine_id=%s err=%v", machine.ID, err)
+
+		return
+	}
+
+	if err := options.Store.SaveMachineFile(mf); err != nil {
+		Logger.Warnf("Error storing machine file: machine_id=%s err=%v", machine.ID, err)
+	}
+}
+
+// isNetworkError reports whether err means the API couldn't be reached, e.g. a
+// DNS, connection or timeout error, or a server error from the API or a proxy
+// during an outage, as opposed to an error returned by the API.
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var e net.Error
+	var apiErr *Error
+
+	switch {
+	case errors.As(err, &e) || errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &apiErr):
+		return apiErr.Response != nil && apiErr.Response.Status >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
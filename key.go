@@ -0,0 +1,138 @@
+package keygen
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// VerifyKey checks if a signed license key is genuine without fetching the license,
+// e.g. before activating an offline install. The key's scheme is detected from its
+// format, and the key is verified using PublicKey, or RSAPublicKey for RSA schemes.
+// If the key is genuine, its decoded dataset will be returned. An error will be
+// returned if the key is not genuine, or if the key is not signed, e.g.
+// ErrLicenseKeyNotGenuine or ErrLicenseNotSigned.
+func VerifyKey(key string) ([]byte, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.VerifyKey(key)
+}
+
+// VerifyKey checks if a signed license key is genuine using the config's public
+// keys. See the package-level VerifyKey.
+func (c *Config) VerifyKey(key string) ([]byte, error) {
+	scheme, err := keyScheme(key)
+	if err != nil {
+		return nil, err
+	}
+
+	license := &License{Key: key, Scheme: scheme, config: c}
+
+	dataset, err := license.Verify()
+	if err == ErrLicenseKeyNotGenuine && scheme == SchemeCodeRSA2048PKCS1SignV2 {
+		// RSA keys may use PKCS#1 v1.5 or PSS signatures, which look the same
+		license.Scheme = SchemeCodeRSA2048PKCS1PSSSignV2
+
+		return license.Verify()
+	}
+
+	return dataset, err
+}
+
+// VerifyKeyDataset verifies a signed license key like VerifyKey, and unmarshals the
+// key's JSON dataset into v, e.g. a struct embedding KeyClaims.
+func VerifyKeyDataset(key string, v interface{}) error {
+	var config *Config // nil uses the package-level globals
+
+	return config.VerifyKeyDataset(key, v)
+}
+
+// VerifyKeyDataset verifies a signed license key using the config's public keys,
+// and unmarshals its dataset. See the package-level VerifyKeyDataset.
+func (c *Config) VerifyKeyDataset(key string, v interface{}) error {
+	dataset, err := c.VerifyKey(key)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalKeyDataset(dataset, v)
+}
+
+// KeyClaims represents common claims embedded in a signed license key's dataset.
+// It can be used on its own, or embedded in a struct containing any custom claims,
+// and decoded using License.VerifyDataset.
+type KeyClaims struct {
+	// Expiry is the license's expiration, e.g. from a dataset template using the
+	// license's {{expiry}} attribute.
+	Expiry *time.Time `json:"expiry,omitempty"`
+
+	// Exp is the license's expiration as a Unix timestamp, e.g. from a JWT key.
+	Exp *int64 `json:"exp,omitempty"`
+
+	// Entitlements are the entitlement codes granted by the license.
+	Entitlements []EntitlementCode `json:"entitlements,omitempty"`
+}
+
+// ExpiresAt returns the key's expiration, or nil when it doesn't expire.
+func (c KeyClaims) ExpiresAt() *time.Time {
+	switch {
+	case c.Expiry != nil:
+		return c.Expiry
+	case c.Exp != nil:
+		t := time.Unix(*c.Exp, 0)
+
+		return &t
+	default:
+		return nil
+	}
+}
+
+// Expired reports whether the key's expiration has passed, using the DefaultClock.
+func (c KeyClaims) Expired() bool {
+	t := c.ExpiresAt()
+
+	return t != nil && defaultClock().Now().After(*t)
+}
+
+// unmarshalKeyDataset decodes a verified key's JSON dataset into v.
+func unmarshalKeyDataset(dataset []byte, v interface{}) error {
+	if err := json.Unmarshal(dataset, v); err != nil {
+		return ErrLicenseKeyDatasetInvalid
+	}
+
+	return nil
+}
+
+// keyScheme detects a signed key's scheme from its format. Keys in the format
+// key/{dataset}.{signature} are Ed25519 or RSA depending on their signature's
+// size, and keys in the format {header}.{payload}.{signature} are JWTs.
+func keyScheme(key string) (SchemeCode, error) {
+	switch {
+	case key == "":
+		return "", ErrLicenseKeyMissing
+	case strings.HasPrefix(key, "key/"):
+		_, encSig, _ := cut(key, ".")
+
+		sig, err := base64.URLEncoding.DecodeString(encSig)
+		if err != nil {
+			return "", ErrLicenseKeyNotGenuine
+		}
+
+		switch len(sig) {
+		case ed25519.SignatureSize:
+			return SchemeCodeEd25519, nil
+		case 2048 / 8:
+			return SchemeCodeRSA2048PKCS1SignV2, nil
+		default:
+			return "", ErrLicenseKeyNotGenuine
+		}
+	case strings.Count(key, ".") == 2:
+		return SchemeCodeRSA2048JWTRS256, nil
+	case strings.ContainsAny(key, "./"):
+		return "", ErrLicenseKeyNotGenuine
+	default:
+		return "", ErrLicenseNotSigned
+	}
+}
@@ -45,6 +45,10 @@ var (
 	// and API response signatures.
 	PublicKey string
 
+	// RSAPublicKey is the Keygen PEM-encoded RSA-2048 public key used for
+	// verifying license keys and license files signed using RSA.
+	RSAPublicKey string
+
 	// UserAgent defines the user-agent string sent to the API backend,
 	// uniquely identifying an integration.
 	UserAgent string
@@ -63,8 +67,18 @@ var (
 	// attacks. Set to -1 to disable.
 	MaxClockDrift = time.Duration(5) * time.Minute
 
+	// DefaultClock is the clock used for time-based checks, e.g. clock drift,
+	// expiry and heartbeat timing. Set this to a trusted time source, or to a
+	// fake clock in tests. Defaults to the system clock.
+	DefaultClock Clock = SystemClock{}
+
 	// HTTPClient is the internal HTTP client used by the SDK for API
 	// requests. Set this to a custom HTTP client, to implement e.g.
 	// automatic retries, rate limiting checks, or for tests.
 	HTTPClient = cleanhttp.DefaultPooledClient()
+
+	// Retry is the retry policy used for API requests that fail due to
+	// network errors, rate limiting or server errors. By default, failed
+	// requests are not retried.
+	Retry *RetryPolicy
 )
@@ -3,10 +3,31 @@ package keygen
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/denisbrodbeck/machineid"
@@ -640,3 +661,2187 @@ func TestHTTPClient(t *testing.T) {
 
 	HTTPClient = re.StandardClient()
 }
+
+func TestRetry(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("Content-Type", "application/vnd.api+json")
+			w.Write([]byte(`{"data":{"id":"1","type":"licenses","attributes":{"key":"TEST"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := NewClientWithOptions(&ClientOptions{
+		APIURL: srv.URL,
+		Retry:  &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	})
+
+	// Don't use the package-level HTTPClient, which may retry on its own
+	client.HTTPClient = http.DefaultClient
+
+	license := &License{}
+	if _, err := client.Post(ctx, "licenses/1/actions/validate", validate{}, license); err != nil {
+		t.Fatalf("Should retry failed requests: err=%v", err)
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("Should have made 3 attempts: attempts=%d", n)
+	}
+
+	if license.Key != "TEST" {
+		t.Fatalf("Should have decoded the final response: license=%v", license)
+	}
+
+	// Exhausted attempts
+	atomic.StoreInt32(&attempts, 0)
+	client.Retry.MaxAttempts = 2
+
+	if _, err := client.Get(ctx, "me", nil, license); err == nil {
+		t.Fatalf("Should fail after exhausting attempts: attempts=%d", atomic.LoadInt32(&attempts))
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Fatalf("Should have made 2 attempts: attempts=%d", n)
+	}
+
+	// Non-idempotent requests
+	atomic.StoreInt32(&attempts, 1)
+	client.Retry.MaxAttempts = 3
+
+	if _, err := client.Post(ctx, "machines", nil, nil); err == nil {
+		t.Fatalf("Should not retry a create after a server error: attempts=%d", atomic.LoadInt32(&attempts))
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Fatalf("Should have made 1 attempt: attempts=%d", n-1)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+
+	if _, err := client.Post(ctx, "machines", nil, nil); err == nil {
+		t.Fatalf("Should not retry a create after a server error: attempts=%d", atomic.LoadInt32(&attempts))
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Fatalf("Should retry a create when rate limited: attempts=%d", n)
+	}
+
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, closed.URL+"/v1/machines", nil)
+	if _, err := http.DefaultClient.Do(req); !client.Retry.retryable(req, nil, err) {
+		t.Fatalf("Should retry a create that never reached the server: err=%v", err)
+	}
+
+	// Cancelled context
+	atomic.StoreInt32(&attempts, 0)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Minute}
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.Get(ctx, "me", nil, license); err != context.DeadlineExceeded {
+		t.Fatalf("Should stop retrying when the context is done: err=%v", err)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	const n = 5
+
+	// Block every request until all of them are in flight, which would
+	// deadlock if requests were serialized.
+	var inflight sync.WaitGroup
+	inflight.Add(n)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflight.Done()
+		inflight.Wait()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClientWithOptions(&ClientOptions{APIURL: srv.URL})
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := client.Get(ctx, "me", nil, nil)
+
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Should perform concurrent requests: err=%v", err)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var auths []string
+	var bodies []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		auths = append(auths, r.Header.Get("Authorization"))
+		bodies = append(bodies, string(body))
+
+		switch r.URL.Path {
+		case "/v1/me":
+			w.Write([]byte(`{"data":{"id":"1","type":"licenses","attributes":{"key":"TEST"}}}`))
+		case "/v1/licenses/1/actions/validate":
+			w.Write([]byte(`{"data":{"id":"1","type":"licenses","attributes":{"key":"TEST"}},"meta":{"valid":true,"code":"VALID"}}`))
+		case "/v1/machines":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"data":{"id":"2","type":"machines","attributes":{"fingerprint":"fp"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	config := &Config{APIURL: srv.URL, Product: "product-1", LicenseKey: "key-1"}
+
+	license, err := config.Validate(ctx, "fp")
+	if err != nil {
+		t.Fatalf("Should validate using the config: err=%v", err)
+	}
+
+	if _, err := license.Activate(ctx, "fp"); err != nil {
+		t.Fatalf("Should activate using the config: err=%v", err)
+	}
+
+	for _, auth := range auths {
+		if auth != "License key-1" {
+			t.Fatalf("Should authenticate using the config's license key: auth=%s", auth)
+		}
+	}
+
+	if !strings.Contains(bodies[1], `"product":"product-1"`) {
+		t.Fatalf("Should scope validation to the config's product: body=%s", bodies[1])
+	}
+}
+
+func TestPagination(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch {
+		case r.URL.Query().Get("page[number]") == "1":
+			w.Write([]byte(`{"data":[{"id":"1","type":"machines","attributes":{}},{"id":"2","type":"machines","attributes":{}}],"links":{"next":"/v1/licenses/1/machines?page%5Bcursor%5D=2&page%5Bsize%5D=2"}}`))
+		case r.URL.Query().Get("page[cursor]") == "2" && r.URL.Query().Get("page[size]") == "2":
+			w.Write([]byte(`{"data":[{"id":"3","type":"machines","attributes":{}}],"links":{"next":"/v1/licenses/1/machines?page%5Bcursor%5D=2&page%5Bsize%5D=2"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	license := &License{ID: "1", config: &Config{APIURL: srv.URL, HTTPClient: http.DefaultClient}}
+
+	machines, err := license.AllMachines(ctx)
+	if err != nil {
+		t.Fatalf("Should list all machines: err=%v", err)
+	}
+
+	if n := len(machines); n != 3 {
+		t.Fatalf("Should follow the next page link as given: machines=%d", n)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("Should not follow a next page link that's been seen: requests=%d", n)
+	}
+
+	for i, machine := range machines {
+		if id := strconv.Itoa(i + 1); machine.ID != id {
+			t.Fatalf("Should list machines in order: actual=%s expected=%s", machine.ID, id)
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	pings := 0
+
+	heartbeat := newHeartbeat(func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if pings++; pings > 2 {
+			return ErrHeartbeatDead
+		}
+
+		return nil
+	}, 20*time.Millisecond, SystemClock{})
+
+	heartbeat.start(context.Background())
+
+	select {
+	case <-heartbeat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Should stop when the heartbeat is dead")
+	}
+
+	if err := heartbeat.Err(); err != ErrHeartbeatDead {
+		t.Fatalf("Should report a dead heartbeat: err=%v", err)
+	}
+
+	if err := <-heartbeat.Errors(); err != ErrHeartbeatDead {
+		t.Fatalf("Should emit a dead heartbeat: err=%v", err)
+	}
+
+	if heartbeat.LastPing().IsZero() {
+		t.Fatalf("Should track the last successful ping")
+	}
+
+	// Cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	heartbeat = newHeartbeat(func(ctx context.Context) error { return nil }, time.Hour, SystemClock{})
+	heartbeat.start(ctx)
+	cancel()
+
+	select {
+	case <-heartbeat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Should stop when the context is cancelled")
+	}
+
+	if err := heartbeat.Err(); err != context.Canceled {
+		t.Fatalf("Should report a cancelled context: err=%v", err)
+	}
+
+	// Errors that retrying can't fix
+	terminal := []error{
+		ErrLicenseSuspended,
+		ErrTokenInvalid,
+		&LicenseTokenError{&Error{Response: &Response{Status: http.StatusUnauthorized}}},
+		&NotAuthorizedError{&Error{Response: &Response{Status: http.StatusForbidden}}},
+	}
+
+	for _, err := range terminal {
+		if !isHeartbeatTerminal(err) {
+			t.Fatalf("Should stop on a terminal error: err=%v", err)
+		}
+	}
+
+	retryable := []error{
+		errors.New("network error"),
+		&Error{Response: &Response{Status: http.StatusBadGateway}},
+		&RateLimitError{Err: &Error{Response: &Response{Status: http.StatusTooManyRequests}}},
+	}
+
+	for _, err := range retryable {
+		if isHeartbeatTerminal(err) {
+			t.Fatalf("Should retry a retryable error: err=%v", err)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/machines/4/actions/ping" {
+			w.Write([]byte(`{"data":{"id":"4","type":"machines","attributes":{"heartbeatDuration":600}}}`))
+
+			return
+		}
+
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/machines/3":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			deleted = append(deleted, r.URL.Path)
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	config := &Config{APIURL: srv.URL, HTTPClient: http.DefaultClient}
+	lifecycle := &Lifecycle{}
+
+	lifecycle.TrackMachine(&Machine{ID: "1", config: config})
+	lifecycle.TrackMachine(&Machine{ID: "3", config: config})
+	lifecycle.TrackProcess(&Process{ID: "2", config: config})
+
+	results := lifecycle.Shutdown(context.Background())
+	if n := len(results); n != 3 {
+		t.Fatalf("Should report a result for each resource: results=%d", n)
+	}
+
+	if deleted[0] != "/v1/processes/2" {
+		t.Fatalf("Should kill processes before deactivating machines: deleted=%v", deleted)
+	}
+
+	for _, res := range results {
+		switch {
+		case res.Machine != nil && res.Machine.ID == "3":
+			if res.Err == nil {
+				t.Fatalf("Should report failed deactivations")
+			}
+		case res.Err != nil:
+			t.Fatalf("Should clean up resource: err=%v", res.Err)
+		}
+	}
+
+	// Failed resources are still tracked
+	if results := lifecycle.Shutdown(context.Background()); len(results) != 1 {
+		t.Fatalf("Should retry failed resources: results=%v", results)
+	}
+
+	// Heartbeats are stopped before deactivating
+	lifecycle = &Lifecycle{}
+	machine := &Machine{ID: "4", config: config}
+
+	heartbeat, err := lifecycle.StartHeartbeat(context.Background(), machine)
+	if err != nil {
+		t.Fatalf("Should start a heartbeat: err=%v", err)
+	}
+
+	lifecycle.TrackMachine(machine)
+	lifecycle.Shutdown(context.Background())
+
+	select {
+	case <-heartbeat.Done():
+	default:
+		t.Fatalf("Should stop heartbeats on shutdown")
+	}
+
+	if err := heartbeat.Err(); err != context.Canceled {
+		t.Fatalf("Should cancel heartbeats on shutdown: err=%v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Fingerprint strategies are read from the filesystem on Linux only")
+	}
+
+	config := &Config{Product: "product-1"}
+	fsys := fstest.MapFS{
+		"etc/machine-id":                {Data: []byte("0123456789abcdef0123456789abcdef\n")},
+		"sys/class/dmi/id/product_uuid": {Data: []byte("00000000-0000-0000-0000-000000000000\n")},
+	}
+
+	fingerprint, err := config.Fingerprint(FingerprintFS(fsys))
+	if err != nil {
+		t.Fatalf("Should fingerprint the machine: err=%v", err)
+	}
+
+	if fingerprint != protectIdentifier("product-1", "0123456789abcdef0123456789abcdef") {
+		t.Fatalf("Should use the machine ID: fingerprint=%s", fingerprint)
+	}
+
+	other, err := (&Config{Product: "product-2"}).Fingerprint(FingerprintFS(fsys))
+	if err != nil || other == fingerprint {
+		t.Fatalf("Should be specific to the product: fingerprint=%s err=%v", other, err)
+	}
+
+	if _, err := config.Fingerprint(FingerprintFS(fsys), FingerprintStrategies(FingerprintStrategyProductUUID)); err != ErrFingerprintNotAvailable {
+		t.Fatalf("Should ignore placeholder product UUIDs: err=%v", err)
+	}
+
+	// Container
+	fsys[".dockerenv"] = &fstest.MapFile{}
+	fsys["proc/self/cgroup"] = &fstest.MapFile{Data: []byte("0::/\n12:memory:/docker/" + strings.Repeat("ab", 32) + "\n")}
+
+	if host, err := config.Fingerprint(FingerprintFS(fsys)); err != nil || host != fingerprint {
+		t.Fatalf("Should use the machine ID by default inside a container: fingerprint=%s err=%v", host, err)
+	}
+
+	container, err := config.Fingerprint(FingerprintFS(fsys), FingerprintStrategies(FingerprintStrategyContainer, FingerprintStrategyMachineID))
+	if err != nil {
+		t.Fatalf("Should fingerprint the container: err=%v", err)
+	}
+
+	if container != protectIdentifier("product-1", strings.Repeat("ab", 32)) {
+		t.Fatalf("Should use the container ID when opted in: fingerprint=%s", container)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Components are read from the filesystem on Linux only")
+	}
+
+	config := &Config{Product: "product-1"}
+	fsys := fstest.MapFS{
+		"proc/cpuinfo": {Data: []byte(
+			"processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU\nphysical id\t: 0\n\n" +
+				"processor\t: 1\nmodel name\t: Intel(R) Xeon(R) CPU\nphysical id\t: 0\n\n",
+		)},
+		"sys/block/sda/device/serial":      {Data: []byte("S3Z9NB0K\n")},
+		"sys/block/sda/device/model":       {Data: []byte("Samsung SSD 860\n")},
+		"sys/block/loop0/device/serial":    {Data: []byte("loop\n")},
+		"sys/class/net/eth0/address":       {Data: []byte("AA:BB:CC:DD:EE:FF\n")},
+		"sys/class/net/eth0/device/vendor": {Data: []byte("0x8086\n")},
+		"sys/class/net/lo/address":         {Data: []byte("00:00:00:00:00:00\n")},
+		"sys/class/net/docker0/address":    {Data: []byte("02:42:ac:11:00:02\n")},
+		"sys/class/dmi/id/board_serial":    {Data: []byte("To be filled by O.E.M.\n")},
+		"sys/class/dmi/id/board_vendor":    {Data: []byte("ASUSTeK\n")},
+	}
+
+	components, err := config.CollectComponents(ComponentFS(fsys))
+	if err != nil {
+		t.Fatalf("Should collect components: err=%v", err)
+	}
+
+	if len(components) != 3 {
+		t.Fatalf("Should collect physical components only: components=%v", components)
+	}
+
+	expected := map[string]string{
+		protectIdentifier("product-1", "cpu:0:Intel(R) Xeon(R) CPU"): "Intel(R) Xeon(R) CPU",
+		protectIdentifier("product-1", "disk:S3Z9NB0K"):              "Samsung SSD 860",
+		protectIdentifier("product-1", "net:aa:bb:cc:dd:ee:ff"):      "eth0",
+	}
+
+	for _, component := range components {
+		if name, ok := expected[component.Fingerprint]; !ok || name != component.Name {
+			t.Fatalf("Should have a hashed fingerprint and name: component=%v", component)
+		}
+	}
+
+	if fingerprints := components.Fingerprints(); len(fingerprints) != 3 {
+		t.Fatalf("Should return component fingerprints: fingerprints=%v", fingerprints)
+	}
+
+	// Motherboard
+	fsys["sys/class/dmi/id/board_serial"] = &fstest.MapFile{Data: []byte("MB-1234\n")}
+	fsys["sys/class/dmi/id/board_name"] = &fstest.MapFile{Data: []byte("PRIME Z390\n")}
+
+	components, err = config.CollectComponents(ComponentFS(fsys), ComponentCollectors(CollectMotherboard))
+	if err != nil {
+		t.Fatalf("Should collect the motherboard: err=%v", err)
+	}
+
+	if len(components) != 1 || components[0].Name != "ASUSTeK PRIME Z390" {
+		t.Fatalf("Should collect the motherboard: components=%v", components)
+	}
+
+	if _, err := (&Config{}).CollectComponents(ComponentFS(fsys)); err != ErrFingerprintProductMissing {
+		t.Fatalf("Should require a product: err=%v", err)
+	}
+}
+
+func newTestCertificate(t *testing.T, privateKey ed25519.PrivateKey, kind string, secret string, data string) string {
+	t.Helper()
+
+	sign := func(msg []byte) []byte { return ed25519.Sign(privateKey, msg) }
+
+	return newTestCertificateWithAlg(t, sign, "aes-256-gcm+ed25519", kind, secret, data)
+}
+
+func newTestCertificateWithAlg(t *testing.T, sign func(msg []byte) []byte, alg string, kind string, secret string, data string) string {
+	t.Helper()
+
+	enc := base64.StdEncoding.EncodeToString([]byte(data))
+	if !strings.HasPrefix(alg, "base64+") {
+		enc = newTestCiphertext(t, secret, data)
+	}
+
+	sig := sign([]byte(kind + "/" + enc))
+	cert, err := json.Marshal(certificate{Enc: enc, Sig: base64.StdEncoding.EncodeToString(sig), Alg: alg})
+	if err != nil {
+		t.Fatalf("Should marshal certificate: err=%v", err)
+	}
+
+	header := strings.ToUpper(kind) + " FILE"
+
+	return "-----BEGIN " + header + "-----\n" + base64.StdEncoding.EncodeToString(cert) + "\n-----END " + header + "-----\n"
+}
+
+func newTestCiphertext(t *testing.T, secret string, data string) string {
+	t.Helper()
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatalf("Should create cipher: err=%v", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("Should create cipher: err=%v", err)
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("Should generate iv: err=%v", err)
+	}
+
+	sealed := gcm.Seal(nil, iv, []byte(data), nil)
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return base64.StdEncoding.EncodeToString(ciphertext) + "." +
+		base64.StdEncoding.EncodeToString(iv) + "." +
+		base64.StdEncoding.EncodeToString(tag)
+}
+
+func TestValidateOffline(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	config := &Config{PublicKey: hex.EncodeToString(publicKey), Product: "product-1", LicenseKey: "key-1"}
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	lic := &LicenseFile{Certificate: newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "ACTIVE", "expiry": null}},
+		"included": [{"id": "ent-1", "type": "entitlements", "attributes": {"code": "FEATURE_A"}}],
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	mf := &MachineFile{Certificate: newTestCertificate(t, privateKey, "machine", "key-1"+"fp-1", `{
+		"data": {"id": "mach-1", "type": "machines", "attributes": {"fingerprint": "fp-1"}, "relationships": {"license": {"data": {"type": "licenses", "id": "lic-1"}}}},
+		"included": [
+			{"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "ACTIVE", "expiry": null}},
+			{"id": "comp-1", "type": "components", "attributes": {"fingerprint": "cfp-1"}}
+		],
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	license, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, MachineFile: mf, Entitlements: []EntitlementCode{"FEATURE_A"}}, "fp-1", "cfp-1")
+	if err != nil {
+		t.Fatalf("Should be valid: err=%v", err)
+	}
+
+	if license.ID != "lic-1" || license.LastValidation == nil || !license.LastValidation.Valid {
+		t.Fatalf("Should return the license and result: license=%v", license)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic}); err != nil {
+		t.Fatalf("Should be valid without a fingerprint: err=%v", err)
+	}
+
+	if license, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic}, "fp-1"); err != ErrLicenseNotActivated || license.LastValidation.Code != ValidationCodeNoMachine {
+		t.Fatalf("Should not be activated without a machine file: err=%v", err)
+	}
+
+	if license, err := config.ValidateOffline(OfflineOptions{MachineFile: mf}, "fp-2"); err != ErrLicenseNotActivated || license.LastValidation.Err() != ErrFingerprintNotActivated || license.LastValidation.Code != ValidationCodeFingerprintScopeMismatch {
+		t.Fatalf("Should not be activated for another fingerprint: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{MachineFile: mf}, "fp-1", "cfp-2"); err != ErrComponentNotActivated {
+		t.Fatalf("Should not be activated for another component: err=%v", err)
+	}
+
+	if license, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, Entitlements: []EntitlementCode{"FEATURE_B"}}); err != ErrLicenseInvalid || license.LastValidation.Err() != ErrLicenseEntitlementsMissing || license.LastValidation.Code != ValidationCodeEntitlementsMissing {
+		t.Fatalf("Should be missing entitlements: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LicenseKey: "key-2"}); err == nil {
+		t.Fatalf("Should not decrypt using another key: err=%v", err)
+	}
+
+	corrupt := &MachineFile{Certificate: newTestCertificate(t, privateKey, "machine", "key-1"+"fp-1", `{`)}
+
+	var e *MachineFileError
+	if _, err := config.ValidateOffline(OfflineOptions{MachineFile: corrupt}, "fp-1"); !errors.As(err, &e) {
+		t.Fatalf("Should return the machine file error: err=%v", err)
+	}
+
+	sign := func(msg []byte) []byte { return ed25519.Sign(privateKey, msg) }
+	unencrypted := &LicenseFile{Certificate: newTestCertificateWithAlg(t, sign, "base64+ed25519", "license", "", `{
+		"data": {"id": "lic-2", "type": "licenses", "attributes": {"key": "key-2", "status": "ACTIVE", "expiry": null}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: unencrypted}); err != ErrLicenseInvalid {
+		t.Fatalf("Should be invalid for another license key: err=%v", err)
+	}
+
+	other := *config
+	other.PublicKey = strings.Repeat("0", 64)
+
+	if _, err := other.ValidateOffline(OfflineOptions{LicenseFile: lic}); !errors.Is(err, ErrLicenseFileNotGenuine) {
+		t.Fatalf("Should not be genuine: err=%v", err)
+	}
+
+	expired := &LicenseFile{Certificate: newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "EXPIRED", "expiry": "2020-01-01T00:00:00Z"}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	if license, err := config.ValidateOffline(OfflineOptions{LicenseFile: expired}); err != ErrLicenseExpired || license.LastValidation.Code != ValidationCodeExpired {
+		t.Fatalf("Should be expired: err=%v", err)
+	}
+
+	banned := &LicenseFile{Certificate: newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "BANNED", "expiry": null}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	if license, err := config.ValidateOffline(OfflineOptions{LicenseFile: banned}); err != ErrLicenseInvalid || license.LastValidation.Code != ValidationCodeBanned || license.LastValidation.Err() != ErrLicenseBanned {
+		t.Fatalf("Should be banned like an online validation: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{}); err != ErrValidationFileMissing {
+		t.Fatalf("Should require a file: err=%v", err)
+	}
+}
+
+func TestValidateHybrid(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	meta := `"meta": {"issued": "` + issued + `", "expiry": "` + expiry + `", "ttl": 3600}`
+
+	lic, _ := json.Marshal(newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "ACTIVE"}}, `+meta+`
+	}`))
+
+	mf, _ := json.Marshal(newTestCertificate(t, privateKey, "machine", "key-1fp-1", `{
+		"data": {"id": "mach-1", "type": "machines", "attributes": {"fingerprint": "fp-1"}},
+		"included": [{"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "ACTIVE"}}], `+meta+`
+	}`))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/me":
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}}}`))
+		case "/v1/licenses/lic-1/actions/validate":
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":true,"code":"VALID"}}`))
+		case "/v1/licenses/lic-1/actions/check-out":
+			w.Write([]byte(`{"data":{"id":"lf-1","type":"license-files","attributes":{"certificate":` + string(lic) + `,"ttl":3600}}}`))
+		case "/v1/machines/fp-1":
+			w.Write([]byte(`{"data":{"id":"mach-1","type":"machines","attributes":{"fingerprint":"fp-1"}}}`))
+		case "/v1/machines/mach-1/actions/check-out":
+			w.Write([]byte(`{"data":{"id":"mf-1","type":"machine-files","attributes":{"certificate":` + string(mf) + `,"ttl":3600}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	ctx := context.Background()
+	store := &MemoryStore{}
+	config := &Config{APIURL: srv.URL, LicenseKey: "key-1", HTTPClient: http.DefaultClient}
+
+	if _, err := config.ValidateHybrid(ctx, HybridOptions{Store: &MemoryStore{}}); err != nil {
+		t.Fatalf("Should validate online: err=%v", err)
+	}
+
+	license, err := config.ValidateHybrid(ctx, HybridOptions{Store: store}, "fp-1")
+	if err != nil {
+		t.Fatalf("Should validate online: err=%v", err)
+	}
+
+	if license.LastValidation.Source != ValidationSourceNetwork {
+		t.Fatalf("Should be validated by the network: source=%s", license.LastValidation.Source)
+	}
+
+	if _, err := store.LoadLicenseFile(); err != nil {
+		t.Fatalf("Should store a license file: err=%v", err)
+	}
+
+	if _, err := store.LoadMachineFile(); err != nil {
+		t.Fatalf("Should store a machine file: err=%v", err)
+	}
+
+	// Take the API offline
+	srv.Close()
+
+	offline := &Config{APIURL: srv.URL, LicenseKey: "key-1", PublicKey: hex.EncodeToString(publicKey), HTTPClient: http.DefaultClient}
+
+	license, err = offline.ValidateHybrid(ctx, HybridOptions{Store: store}, "fp-1")
+	if err != nil {
+		t.Fatalf("Should fallback to the cache: err=%v", err)
+	}
+
+	if license.ID != "lic-1" || license.LastValidation.Source != ValidationSourceCache {
+		t.Fatalf("Should be validated by the cache: license=%v", license)
+	}
+
+	if _, err := offline.ValidateHybrid(ctx, HybridOptions{Store: store}, "fp-2"); err != ErrLicenseNotActivated {
+		t.Fatalf("Should validate the fingerprint against the cache: err=%v", err)
+	}
+
+	if _, err := offline.ValidateHybrid(ctx, HybridOptions{Store: store, GracePeriod: time.Nanosecond}, "fp-1"); err != ErrLicenseFileExpired {
+		t.Fatalf("Should not use the cache outside of the grace period: err=%v", err)
+	}
+
+	if _, err := offline.ValidateHybrid(ctx, HybridOptions{Store: &MemoryStore{}}, "fp-1"); !isNetworkError(err) {
+		t.Fatalf("Should return the network error without a cache: err=%v", err)
+	}
+
+	tokenOnly := &Config{APIURL: srv.URL, Token: "token-1", PublicKey: offline.PublicKey, HTTPClient: http.DefaultClient}
+	if _, err := tokenOnly.ValidateHybrid(ctx, HybridOptions{Store: store}, "fp-1"); !isNetworkError(err) {
+		t.Fatalf("Should return the network error without a license key: err=%v", err)
+	}
+
+	// Server errors, e.g. from a proxy during an outage
+	outage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer outage.Close()
+
+	unavailable := &Config{APIURL: outage.URL, LicenseKey: "key-1", PublicKey: offline.PublicKey, HTTPClient: http.DefaultClient}
+
+	license, err = unavailable.ValidateHybrid(ctx, HybridOptions{Store: store}, "fp-1")
+	if err != nil || license.LastValidation.Source != ValidationSourceCache {
+		t.Fatalf("Should fallback to the cache on server errors: err=%v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	issued := time.Now().UTC().Truncate(time.Second)
+	lic := &LicenseFile{ID: "lf-1", Type: "license-files", Certificate: "-----BEGIN LICENSE FILE-----\nabc\n-----END LICENSE FILE-----\n", Issued: issued, Expiry: issued.Add(time.Hour), TTL: 3600, LicenseID: "lic-1"}
+	mf := &MachineFile{ID: "mf-1", Type: "machine-files", Certificate: "-----BEGIN MACHINE FILE-----\nabc\n-----END MACHINE FILE-----\n", MachineID: "mach-1", LicenseID: "lic-1"}
+
+	for _, store := range []*FileStore{{Dir: dir + "/plain"}, {Dir: dir + "/encrypted", LicenseKey: "key-1"}} {
+		if _, err := store.LoadLicenseFile(); err != ErrStoredFileNotFound {
+			t.Fatalf("Should not find a license file: err=%v", err)
+		}
+
+		if err := store.SaveLicenseFile(lic); err != nil {
+			t.Fatalf("Should save the license file: err=%v", err)
+		}
+
+		if err := store.SaveMachineFile(mf); err != nil {
+			t.Fatalf("Should save the machine file: err=%v", err)
+		}
+
+		loaded, err := store.LoadLicenseFile()
+		if err != nil {
+			t.Fatalf("Should load the license file: err=%v", err)
+		}
+
+		if *loaded != *lic {
+			t.Fatalf("Should load the saved license file: actual=%v expected=%v", loaded, lic)
+		}
+
+		if loaded, err := store.LoadMachineFile(); err != nil || *loaded != *mf {
+			t.Fatalf("Should load the saved machine file: err=%v", err)
+		}
+
+		data, err := os.ReadFile(store.Dir + "/license.json")
+		if err != nil {
+			t.Fatalf("Should write the license file: err=%v", err)
+		}
+
+		if encrypted := !bytes.Contains(data, []byte("BEGIN LICENSE FILE")); encrypted != (store.LicenseKey != "") {
+			t.Fatalf("Should only encrypt at rest when a license key is set: encrypted=%v", encrypted)
+		}
+
+		if err := store.Clear(); err != nil {
+			t.Fatalf("Should clear the store: err=%v", err)
+		}
+
+		if _, err := store.LoadMachineFile(); err != ErrStoredFileNotFound {
+			t.Fatalf("Should not find a cleared machine file: err=%v", err)
+		}
+	}
+
+	store := &FileStore{Dir: dir, LicenseKey: "key-1"}
+	if err := store.SaveLicenseFile(lic); err != nil {
+		t.Fatalf("Should save the license file: err=%v", err)
+	}
+
+	if _, err := (&FileStore{Dir: dir, LicenseKey: "key-2"}).LoadLicenseFile(); err != ErrStoredFileInvalid {
+		t.Fatalf("Should not decrypt using another license key: err=%v", err)
+	}
+}
+
+func TestParseLicenseFile(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	cert := newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1"}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)
+
+	// Rewrap the payload using CRLF line endings, like a file sent by email
+	payload := strings.TrimSuffix(strings.TrimPrefix(cert, "-----BEGIN LICENSE FILE-----\n"), "\n-----END LICENSE FILE-----\n")
+	var wrapped []string
+	for len(payload) > 60 {
+		wrapped, payload = append(wrapped, payload[:60]), payload[60:]
+	}
+
+	wrapped = append(wrapped, payload)
+	crlf := "-----BEGIN LICENSE FILE-----\r\n" + strings.Join(wrapped, "\r\n") + "\r\n-----END LICENSE FILE-----\r\n"
+
+	path := t.TempDir() + "/license.lic"
+	if err := os.WriteFile(path, []byte(crlf), 0600); err != nil {
+		t.Fatalf("Should write the license file: err=%v", err)
+	}
+
+	lic, err := LoadLicenseFile(path)
+	if err != nil {
+		t.Fatalf("Should load the license file: err=%v", err)
+	}
+
+	lic.config = &Config{PublicKey: hex.EncodeToString(publicKey)}
+
+	if err := lic.Verify(); err != nil {
+		t.Fatalf("Should verify the license file: err=%v", err)
+	}
+
+	if dataset, err := lic.Decrypt("key-1"); err != nil || dataset.License.ID != "lic-1" {
+		t.Fatalf("Should decrypt the license file: err=%v", err)
+	}
+
+	if _, err := ParseLicenseFile(strings.Join(wrapped, "\n")); err != nil {
+		t.Fatalf("Should parse a raw certificate: err=%v", err)
+	}
+
+	var e *ArmorError
+
+	if _, err := ReadMachineFile(strings.NewReader(crlf)); !errors.As(err, &e) || e.Actual != "LICENSE FILE" {
+		t.Fatalf("Should not parse a license file as a machine file: err=%v", err)
+	}
+
+	if _, err := ParseLicenseFile("-----BEGIN LICENSE FILE-----\nabc\n-----END MACHINE FILE-----\n"); !errors.As(err, &e) {
+		t.Fatalf("Should not parse malformed armor: err=%v", err)
+	}
+}
+
+func TestRSA(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Should marshal public key: err=%v", err)
+	}
+
+	config := &Config{RSAPublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}
+
+	signPKCS1 := func(msg []byte) []byte {
+		digest := sha256.Sum256(msg)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Should sign: err=%v", err)
+		}
+
+		return sig
+	}
+
+	signPSS := func(msg []byte) []byte {
+		digest := sha256.Sum256(msg)
+		sig, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, digest[:], nil)
+		if err != nil {
+			t.Fatalf("Should sign: err=%v", err)
+		}
+
+		return sig
+	}
+
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	data := `{"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1"}}, "meta": {"issued": "` + issued + `", "expiry": "` + expiry + `", "ttl": 3600}}`
+
+	for alg, sign := range map[string]func([]byte) []byte{"aes-256-gcm+rsa-sha256": signPKCS1, "aes-256-gcm+rsa-pss-sha256": signPSS} {
+		lic := &LicenseFile{Certificate: newTestCertificateWithAlg(t, sign, alg, "license", "key-1", data), config: config}
+
+		if err := lic.Verify(); err != nil {
+			t.Fatalf("Should verify the license file: alg=%s err=%v", alg, err)
+		}
+
+		if dataset, err := lic.Decrypt("key-1"); err != nil || dataset.License.ID != "lic-1" {
+			t.Fatalf("Should decrypt the license file: alg=%s err=%v", alg, err)
+		}
+
+		mf := &MachineFile{Certificate: newTestCertificateWithAlg(t, sign, alg, "license", "key-1", data), config: config}
+		mf.Certificate = strings.ReplaceAll(mf.Certificate, "LICENSE FILE", "MACHINE FILE")
+
+		if err := mf.Verify(); !errors.Is(err, ErrMachineFileNotGenuine) {
+			t.Fatalf("Should not verify a license file signature as a machine file: alg=%s err=%v", alg, err)
+		}
+	}
+
+	dataset := base64.URLEncoding.EncodeToString([]byte(`{"id":"lic-1"}`))
+
+	for scheme, sign := range map[SchemeCode]func([]byte) []byte{SchemeCodeRSA2048PKCS1SignV2: signPKCS1, SchemeCodeRSA2048PKCS1PSSSignV2: signPSS} {
+		key := "key/" + dataset + "." + base64.URLEncoding.EncodeToString(sign([]byte("key/"+dataset)))
+		license := &License{Scheme: scheme, Key: key, config: config}
+
+		if decoded, err := license.Verify(); err != nil || string(decoded) != `{"id":"lic-1"}` {
+			t.Fatalf("Should verify the license key: scheme=%s err=%v", scheme, err)
+		}
+
+		license.Key = "key/" + base64.URLEncoding.EncodeToString([]byte(`{"id":"lic-2"}`)) + key[strings.Index(key, "."):]
+
+		if _, err := license.Verify(); err != ErrLicenseKeyNotGenuine {
+			t.Fatalf("Should not verify a tampered license key: scheme=%s err=%v", scheme, err)
+		}
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"id":"lic-1"}`))
+	license := &License{Scheme: SchemeCodeRSA2048JWTRS256, Key: payload + "." + base64.RawURLEncoding.EncodeToString(signPKCS1([]byte(payload))), config: config}
+
+	if decoded, err := license.Verify(); err != nil || string(decoded) != `{"id":"lic-1"}` {
+		t.Fatalf("Should verify the JWT license key: err=%v", err)
+	}
+
+	for scheme, sign := range map[SchemeCode]func([]byte) []byte{SchemeCodeRSA2048PKCS1SignV2: signPKCS1, SchemeCodeRSA2048PKCS1PSSSignV2: signPSS} {
+		key := "key/" + dataset + "." + base64.URLEncoding.EncodeToString(sign([]byte("key/"+dataset)))
+
+		if decoded, err := config.VerifyKey(key); err != nil || string(decoded) != `{"id":"lic-1"}` {
+			t.Fatalf("Should verify the license key without a scheme: scheme=%s err=%v", scheme, err)
+		}
+	}
+
+	if decoded, err := config.VerifyKey(license.Key); err != nil || string(decoded) != `{"id":"lic-1"}` {
+		t.Fatalf("Should verify the JWT license key without a scheme: err=%v", err)
+	}
+
+	if _, err := (&License{Scheme: SchemeCodeRSA2048PKCS1SignV2, Key: "key/abc.def", config: &Config{}}).Verify(); err != ErrPublicKeyMissing {
+		t.Fatalf("Should require an RSA public key: err=%v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	sign := func(msg []byte) []byte { return ed25519.Sign(privateKey, msg) }
+	config := &Config{PublicKey: hex.EncodeToString(publicKey), LicenseKey: "key-1"}
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	meta := `"meta": {"issued": "` + issued + `", "expiry": "` + expiry + `", "ttl": 3600}`
+
+	lic := &LicenseFile{config: config, Certificate: newTestCertificateWithAlg(t, sign, "base64+ed25519", "license", "", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1"}},
+		"included": [{"id": "ent-1", "type": "entitlements", "attributes": {"code": "FEATURE_A"}}], `+meta+`
+	}`)}
+
+	dataset, err := lic.Decode()
+	if err != nil {
+		t.Fatalf("Should decode the license file: err=%v", err)
+	}
+
+	if dataset.License.ID != "lic-1" || len(dataset.Entitlements) != 1 || dataset.TTL != 3600 {
+		t.Fatalf("Should decode the license file's dataset: dataset=%+v", dataset)
+	}
+
+	if _, err := lic.Decrypt("key-1"); err != ErrLicenseFileNotEncrypted {
+		t.Fatalf("Should not decrypt an unencrypted license file: err=%v", err)
+	}
+
+	mf := &MachineFile{config: config, Certificate: newTestCertificateWithAlg(t, sign, "base64+ed25519", "machine", "", `{
+		"data": {"id": "mach-1", "type": "machines", "attributes": {"fingerprint": "fp-1"}},
+		"included": [{"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1"}}], `+meta+`
+	}`)}
+
+	if dataset, err := mf.Decode(); err != nil || dataset.Machine.Fingerprint != "fp-1" || dataset.License.ID != "lic-1" {
+		t.Fatalf("Should decode the machine file: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{MachineFile: mf}, "fp-1"); err != nil {
+		t.Fatalf("Should validate an unencrypted machine file offline: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{MachineFile: mf}, "fp-2"); err != ErrLicenseNotActivated {
+		t.Fatalf("Should check the fingerprint of an unencrypted machine file: err=%v", err)
+	}
+
+	tampered := &LicenseFile{config: config, Certificate: newTestCertificateWithAlg(t, func([]byte) []byte { return make([]byte, ed25519.SignatureSize) }, "base64+ed25519", "license", "", `{}`)}
+
+	if _, err := tampered.Decode(); !errors.Is(err, ErrLicenseFileNotGenuine) {
+		t.Fatalf("Should verify the license file before decoding: err=%v", err)
+	}
+
+	encrypted := &LicenseFile{config: config, Certificate: newTestCertificate(t, privateKey, "license", "key-1", `{}`)}
+
+	if _, err := encrypted.Decode(); err != ErrLicenseFileEncrypted {
+		t.Fatalf("Should not decode an encrypted license file: err=%v", err)
+	}
+
+	opts := CheckoutOptions{Encrypt: true}
+	if err := CheckoutEncrypt(false)(&opts); err != nil || opts.Encrypt {
+		t.Fatalf("Should request an unencrypted file: opts=%+v", opts)
+	}
+}
+
+func TestDatasetIncludes(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	sign := func(msg []byte) []byte { return ed25519.Sign(privateKey, msg) }
+	config := &Config{PublicKey: hex.EncodeToString(publicKey)}
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	meta := `"meta": {"issued": "` + issued + `", "expiry": "` + expiry + `", "ttl": 3600}`
+	license := `{"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1"}, "relationships": {
+		"policy": {"data": {"type": "policies", "id": "pol-1"}},
+		"product": {"data": {"type": "products", "id": "prod-1"}},
+		"owner": {"data": {"type": "users", "id": "user-2"}},
+		"group": {"data": {"type": "groups", "id": "grp-1"}}
+	}}`
+	included := `
+		{"id": "user-1", "type": "users", "attributes": {"email": "other@example.com"}},
+		{"id": "pol-1", "type": "policies", "attributes": {"name": "Pro", "maxMachines": 5, "requireHeartbeat": true, "heartbeatDuration": 600}},
+		{"id": "prod-1", "type": "products", "attributes": {"name": "App", "platforms": ["linux"]}},
+		{"id": "user-2", "type": "users", "attributes": {"email": "owner@example.com", "role": "user"}},
+		{"id": "grp-1", "type": "groups", "attributes": {"name": "Team", "maxMachines": 10}}`
+
+	lic := &LicenseFile{config: config, Certificate: newTestCertificateWithAlg(t, sign, "base64+ed25519", "license", "", `{
+		"data": `+license+`,
+		"included": [`+included+`], `+meta+`
+	}`)}
+
+	dataset, err := lic.Decode()
+	if err != nil {
+		t.Fatalf("Should decode the license file: err=%v", err)
+	}
+
+	switch {
+	case dataset.License.PolicyId != "pol-1" || dataset.License.ProductID != "prod-1" || dataset.License.UserID != "user-2" || dataset.License.GroupID != "grp-1":
+		t.Fatalf("Should have license relationships: license=%+v", dataset.License)
+	case dataset.Policy == nil || dataset.Policy.Name != "Pro" || dataset.Policy.MaxMachines == nil || *dataset.Policy.MaxMachines != 5 || !dataset.Policy.RequireHeartbeat:
+		t.Fatalf("Should have a policy: policy=%+v", dataset.Policy)
+	case dataset.User == nil || dataset.User.Email != "owner@example.com":
+		t.Fatalf("Should have the license's owner: user=%+v", dataset.User)
+	case dataset.Product == nil || dataset.Product.Name != "App" || len(dataset.Product.Platforms) != 1:
+		t.Fatalf("Should have a product: product=%+v", dataset.Product)
+	case dataset.Group == nil || dataset.Group.Name != "Team":
+		t.Fatalf("Should have a group: group=%+v", dataset.Group)
+	}
+
+	mf := &MachineFile{config: config, Certificate: newTestCertificateWithAlg(t, sign, "base64+ed25519", "machine", "", `{
+		"data": {"id": "mach-1", "type": "machines", "attributes": {"fingerprint": "fp-1"}},
+		"included": [`+included+`,
+			{"id": "comp-1", "type": "components", "attributes": {"fingerprint": "cpu-1", "name": "CPU"}},
+			`+license+`
+		], `+meta+`
+	}`)}
+
+	mfd, err := mf.Decode()
+	if err != nil {
+		t.Fatalf("Should decode the machine file: err=%v", err)
+	}
+
+	switch {
+	case mfd.Policy == nil || mfd.Policy.ID != "pol-1" || mfd.Product == nil || mfd.Group == nil:
+		t.Fatalf("Should have includes: dataset=%+v", mfd)
+	case mfd.User == nil || mfd.User.ID != "user-2":
+		t.Fatalf("Should have the license's owner when included before the license: user=%+v", mfd.User)
+	case len(mfd.Components) != 1 || len(mfd.Machine.components) != 1 || mfd.Components[0].Fingerprint != "cpu-1":
+		t.Fatalf("Should have components: components=%+v", mfd.Components)
+	}
+}
+
+func TestVerifyDataset(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	config := &Config{PublicKey: hex.EncodeToString(publicKey)}
+	newKey := func(data string) string {
+		dataset := base64.URLEncoding.EncodeToString([]byte(data))
+
+		return "key/" + dataset + "." + base64.URLEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("key/"+dataset)))
+	}
+
+	var claims struct {
+		KeyClaims
+		Seats int `json:"seats"`
+	}
+
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	license := &License{Scheme: SchemeCodeEd25519, Key: newKey(`{"seats": 5, "entitlements": ["FEATURE_A"], "expiry": "` + expiry.Format(time.RFC3339) + `"}`), config: config}
+
+	if err := license.VerifyDataset(&claims); err != nil {
+		t.Fatalf("Should verify the key's dataset: err=%v", err)
+	}
+
+	switch {
+	case claims.Seats != 5:
+		t.Fatalf("Should decode custom claims: claims=%+v", claims)
+	case len(claims.Entitlements) != 1 || claims.Entitlements[0] != "FEATURE_A":
+		t.Fatalf("Should decode entitlements: claims=%+v", claims)
+	case claims.ExpiresAt() == nil || !claims.ExpiresAt().Equal(expiry) || claims.Expired():
+		t.Fatalf("Should decode expiry: claims=%+v", claims)
+	}
+
+	exp := time.Now().Add(-time.Hour).Unix()
+	if c := (KeyClaims{Exp: &exp}); !c.Expired() || c.ExpiresAt().Unix() != exp {
+		t.Fatalf("Should support JWT expiry: claims=%+v", c)
+	}
+
+	if c := (KeyClaims{}); c.Expired() || c.ExpiresAt() != nil {
+		t.Fatalf("Should not expire without an expiry: claims=%+v", c)
+	}
+
+	license = &License{Scheme: SchemeCodeEd25519, Key: newKey(`not json`), config: config}
+
+	if err := license.VerifyDataset(&claims); err != ErrLicenseKeyDatasetInvalid {
+		t.Fatalf("Should reject a non-JSON dataset: err=%v", err)
+	}
+
+	for _, key := range []string{"invalid", "key", "key.", "key/", "key/abc", "key/.abc", "foo/abc.def", "abc.def"} {
+		license := &License{Scheme: SchemeCodeEd25519, Key: key, config: config}
+
+		if _, err := license.Verify(); err != ErrLicenseKeyNotGenuine {
+			t.Fatalf("Should reject a malformed key: key=%s err=%v", key, err)
+		}
+	}
+}
+
+func TestVerifyKey(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	config := &Config{PublicKey: hex.EncodeToString(publicKey)}
+	dataset := base64.URLEncoding.EncodeToString([]byte(`{"seats":5}`))
+	key := "key/" + dataset + "." + base64.URLEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("key/"+dataset)))
+
+	if decoded, err := config.VerifyKey(key); err != nil || string(decoded) != `{"seats":5}` {
+		t.Fatalf("Should verify the license key: err=%v", err)
+	}
+
+	var claims struct {
+		Seats int `json:"seats"`
+	}
+
+	if err := config.VerifyKeyDataset(key, &claims); err != nil || claims.Seats != 5 {
+		t.Fatalf("Should decode the license key's dataset: err=%v", err)
+	}
+
+	tampered := "key/" + base64.URLEncoding.EncodeToString([]byte(`{"seats":500}`)) + key[strings.Index(key, "."):]
+
+	if _, err := config.VerifyKey(tampered); err != ErrLicenseKeyNotGenuine {
+		t.Fatalf("Should not verify a tampered license key: err=%v", err)
+	}
+
+	for key, expected := range map[string]error{
+		"":                    ErrLicenseKeyMissing,
+		"ABCD-EFGH-IJKL-MNOP": ErrLicenseNotSigned,
+		"key/abc.def":         ErrLicenseKeyNotGenuine,
+		"key/abc":             ErrLicenseKeyNotGenuine,
+		"foo/abc":             ErrLicenseKeyNotGenuine,
+		"a.b.c":               ErrPublicKeyMissing,
+	} {
+		if _, err := config.VerifyKey(key); err != expected {
+			t.Fatalf("Should reject the license key: key=%q err=%v", key, err)
+		}
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	var auths []string
+	var bodies []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		auths = append(auths, r.Header.Get("Authorization"))
+		bodies = append(bodies, string(body))
+
+		switch {
+		case r.URL.Path != "/v1/licenses/actions/validate-key":
+			w.WriteHeader(http.StatusNotFound)
+		case strings.Contains(string(body), `"key":"key-1"`):
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":false,"code":"EXPIRED"}}`))
+		default:
+			w.Write([]byte(`{"data":null,"meta":{"valid":false,"code":"NOT_FOUND"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	config := &Config{APIURL: srv.URL, Product: "product-1", LicenseKey: "key-1", Token: "token-1"}
+
+	license, err := config.ValidateKey(ctx, ValidationOptions{Policy: "policy-1", Entitlements: []EntitlementCode{"FEATURE_A"}}, "fp-1", "cfp-1")
+	if err != ErrLicenseExpired {
+		t.Fatalf("Should validate the key: err=%v", err)
+	}
+
+	if license == nil || license.ID != "lic-1" || license.LastValidation.Code != ValidationCodeExpired || license.LastValidation.Source != ValidationSourceNetwork {
+		t.Fatalf("Should return the license: license=%+v", license)
+	}
+
+	var params struct {
+		Meta struct {
+			Key   string
+			Scope struct {
+				Fingerprint  string
+				Components   []string
+				Product      string
+				Policy       string
+				Entitlements []string
+			}
+		}
+	}
+
+	if err := json.Unmarshal([]byte(bodies[0]), &params); err != nil {
+		t.Fatalf("Should send a JSON body: err=%v", err)
+	}
+
+	switch scope := params.Meta.Scope; {
+	case params.Meta.Key != "key-1":
+		t.Fatalf("Should send the key: body=%s", bodies[0])
+	case scope.Fingerprint != "fp-1" || len(scope.Components) != 1 || scope.Product != "product-1" || scope.Policy != "policy-1" || len(scope.Entitlements) != 1:
+		t.Fatalf("Should send the scope: body=%s", bodies[0])
+	}
+
+	config.LicenseKey = "key-2"
+
+	if license, err := config.ValidateKey(ctx, ValidationOptions{Product: "product-2"}); err != ErrLicenseInvalid || license != nil {
+		t.Fatalf("Should not find the key: license=%+v err=%v", license, err)
+	}
+
+	if !strings.Contains(bodies[1], `"product":"product-2"`) {
+		t.Fatalf("Should override the product: body=%s", bodies[1])
+	}
+
+	for _, auth := range auths {
+		if auth != "" {
+			t.Fatalf("Should not authenticate: auth=%s", auth)
+		}
+	}
+
+	if _, err := (&Config{APIURL: srv.URL}).ValidateKey(ctx, ValidationOptions{}); err != ErrLicenseKeyMissing {
+		t.Fatalf("Should require a key: err=%v", err)
+	}
+}
+
+func TestValidateWithOptions(t *testing.T) {
+	var bodies []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		bodies = append(bodies, string(body))
+
+		switch r.URL.Path {
+		case "/v1/me":
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}}}`))
+		case "/v1/licenses/lic-1/actions/validate":
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":false,"code":"POLICY_SCOPE_MISMATCH","scope":{"policy":"pol-1","machine":"mach-1","user":"user-1","entitlements":["FEATURE_A"]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	config := &Config{APIURL: srv.URL, LicenseKey: "key-1"}
+	options := ValidationOptions{Policy: "pol-1", Machine: "mach-1", User: "user-1", Entitlements: []EntitlementCode{"FEATURE_A"}}
+
+	license, err := config.ValidateWithOptions(ctx, options)
+	if err != ErrLicenseInvalid {
+		t.Fatalf("Should return the general error: err=%v", err)
+	}
+
+	if e := license.LastValidation.Err(); e != ErrValidationPolicyMismatch || !errors.Is(e, ErrLicenseInvalid) {
+		t.Fatalf("Should have the policy scope error: err=%v", e)
+	}
+
+	var e *ValidationCodeError
+	if !errors.As(license.LastValidation.Err(), &e) || e.Code != ValidationCodePolicyScopeMismatch {
+		t.Fatalf("Should have the validation code: err=%v", err)
+	}
+
+	for _, attr := range []string{`"policy":"pol-1"`, `"machine":"mach-1"`, `"user":"user-1"`, `"entitlements":["FEATURE_A"]`} {
+		if !strings.Contains(bodies[1], attr) {
+			t.Fatalf("Should send the scope: attr=%s body=%s", attr, bodies[1])
+		}
+	}
+
+	switch scope := license.LastValidation.Scope; {
+	case scope == nil:
+		t.Fatalf("Should have a scope: validation=%+v", license.LastValidation)
+	case scope.Policy != "pol-1" || scope.Machine != "mach-1" || scope.User != "user-1" || len(scope.Entitlements) != 1:
+		t.Fatalf("Should expose the scope: scope=%+v", scope)
+	}
+
+	codes := []ValidationCode{
+		ValidationCodeNotFound,
+		ValidationCodeSuspended,
+		ValidationCodeBanned,
+		ValidationCodeExpired,
+		ValidationCodeOverdue,
+		ValidationCodeNoMachine,
+		ValidationCodeNoMachines,
+		ValidationCodeTooManyMachines,
+		ValidationCodeTooManyCores,
+		ValidationCodeTooManyProcesses,
+		ValidationCodeFingerprintScopeRequired,
+		ValidationCodeFingerprintScopeMismatch,
+		ValidationCodeFingerprintScopeEmpty,
+		ValidationCodeComponentsScopeRequired,
+		ValidationCodeComponentsScopeMismatch,
+		ValidationCodeComponentsScopeEmpty,
+		ValidationCodeHeartbeatNotStarted,
+		ValidationCodeHeartbeatDead,
+		ValidationCodeProductScopeRequired,
+		ValidationCodeProductScopeMismatch,
+		ValidationCodePolicyScopeRequired,
+		ValidationCodePolicyScopeMismatch,
+		ValidationCodeMachineScopeRequired,
+		ValidationCodeMachineScopeMismatch,
+		ValidationCodeUserScopeRequired,
+		ValidationCodeUserScopeMismatch,
+		ValidationCodeEntitlementsMissing,
+		ValidationCodeEntitlementsEmpty,
+	}
+
+	seen := map[error]ValidationCode{}
+
+	for _, code := range codes {
+		err := (&ValidationResult{Code: code}).Err()
+		if err == nil || err == ErrLicenseInvalid {
+			t.Fatalf("Should have a specific error: code=%s err=%v", code, err)
+		}
+
+		if other, ok := seen[err]; ok {
+			t.Fatalf("Should have a distinct error: code=%s other=%s err=%v", code, other, err)
+		}
+
+		seen[err] = code
+	}
+
+	// Validations return the historical errors, for compatibility
+	compat := map[ValidationCode]error{
+		ValidationCodeNoMachine:                ErrLicenseNotActivated,
+		ValidationCodeNoMachines:               ErrLicenseNotActivated,
+		ValidationCodeFingerprintScopeMismatch: ErrLicenseNotActivated,
+		ValidationCodeFingerprintScopeEmpty:    ErrValidationFingerprintMissing,
+		ValidationCodeComponentsScopeEmpty:     ErrValidationComponentsMissing,
+		ValidationCodeProductScopeMismatch:     ErrValidationProductMissing,
+		ValidationCodeBanned:                   ErrLicenseInvalid,
+		ValidationCodeNotFound:                 ErrLicenseInvalid,
+		ValidationCodePolicyScopeMismatch:      ErrLicenseInvalid,
+	}
+
+	for code, expected := range compat {
+		if err := validationError(code); err != expected {
+			t.Fatalf("Should return the historical error: code=%s err=%v expected=%v", code, err, expected)
+		}
+	}
+
+	if err := validationError(ValidationCodeValid); err != nil {
+		t.Fatalf("Should not have an error: err=%v", err)
+	}
+
+	if err := validationError("UNKNOWN"); err != ErrLicenseInvalid {
+		t.Fatalf("Should fall back to an invalid license: err=%v", err)
+	}
+}
+
+// writeTestSignedResponse writes a response body signed like the API's responses.
+func writeTestSignedResponse(w http.ResponseWriter, r *http.Request, privateKey ed25519.PrivateKey, body string) {
+	date := time.Now().UTC().Format(time.RFC1123)
+	shasum := sha256.Sum256([]byte(body))
+	digest := "sha-256=" + base64.StdEncoding.EncodeToString(shasum[:])
+	msg := fmt.Sprintf("(request-target): %s %s\nhost: %s\ndate: %s\ndigest: %s", strings.ToLower(r.Method), r.URL.RequestURI(), r.Host, date, digest)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(msg)))
+
+	w.Header().Set("Date", date)
+	w.Header().Set("Digest", digest)
+	w.Header().Set("Keygen-Signature", `algorithm="ed25519", signature="`+sig+`", headers="(request-target) host date digest"`)
+	w.Write([]byte(body))
+}
+
+func TestValidationNonce(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	replay := false
+	nonces := []int64{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params struct {
+			Meta struct {
+				Nonce int64 `json:"nonce"`
+			} `json:"meta"`
+		}
+
+		json.NewDecoder(r.Body).Decode(&params)
+
+		nonce := params.Meta.Nonce
+		if replay {
+			nonce = nonces[0]
+		}
+
+		nonces = append(nonces, params.Meta.Nonce)
+
+		switch r.URL.Path {
+		case "/v1/me":
+			writeTestSignedResponse(w, r, privateKey, `{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}}}`)
+		case "/v1/licenses/lic-1/actions/validate", "/v1/licenses/actions/validate-key":
+			writeTestSignedResponse(w, r, privateKey, fmt.Sprintf(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":true,"code":"VALID","nonce":%d}}`, nonce))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	config := &Config{APIURL: srv.URL, LicenseKey: "key-1", PublicKey: hex.EncodeToString(publicKey)}
+
+	license, err := config.ValidateWithOptions(ctx, ValidationOptions{Nonce: true})
+	if err != nil {
+		t.Fatalf("Should validate with a nonce: err=%v", err)
+	}
+
+	if n := nonces[len(nonces)-1]; n == 0 || license.LastValidation.Nonce != n {
+		t.Fatalf("Should send and receive a nonce: nonce=%d validation=%+v", n, license.LastValidation)
+	}
+
+	if _, err := config.ValidateKey(ctx, ValidationOptions{Nonce: true}); err != nil {
+		t.Fatalf("Should validate the key with a nonce: err=%v", err)
+	}
+
+	replay = true
+	nonces = []int64{42}
+
+	if err := license.ValidateWithOptions(ctx, ValidationOptions{Nonce: true}); err != ErrValidationNonceMismatch {
+		t.Fatalf("Should reject a replayed validation: err=%v", err)
+	}
+
+	if license.LastValidation.Nonce == 42 {
+		t.Fatalf("Should not store a replayed validation: validation=%+v", license.LastValidation)
+	}
+
+	if _, err := config.ValidateKey(ctx, ValidationOptions{Nonce: true}); err != ErrValidationNonceMismatch {
+		t.Fatalf("Should reject a replayed key validation: err=%v", err)
+	}
+
+	if err := license.ValidateWithOptions(ctx, ValidationOptions{}); err != nil {
+		t.Fatalf("Should not check the nonce by default: err=%v", err)
+	}
+
+	if _, err := (&Config{APIURL: srv.URL, LicenseKey: "key-1"}).ValidateKey(ctx, ValidationOptions{Nonce: true}); err != ErrPublicKeyMissing {
+		t.Fatalf("Should require a public key: err=%v", err)
+	}
+}
+
+func TestEntitlements(t *testing.T) {
+	var requests int
+	var codes = `{"id":"ent-1","type":"entitlements","attributes":{"code":"FEATURE_A"}}`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/licenses/lic-1/entitlements":
+			requests++
+
+			w.Write([]byte(`{"data":[` + codes + `]}`))
+		case "/v1/licenses/lic-1/actions/validate":
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":true,"code":"VALID"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	license := &License{ID: "lic-1", config: &Config{APIURL: srv.URL, LicenseKey: "key-1"}}
+
+	if ok, err := license.HasEntitlement(ctx, "FEATURE_A"); err != nil || !ok {
+		t.Fatalf("Should have the entitlement: ok=%t err=%v", ok, err)
+	}
+
+	if ok, err := license.HasEntitlement(ctx, "FEATURE_B"); err != nil || ok {
+		t.Fatalf("Should not have the entitlement: ok=%t err=%v", ok, err)
+	}
+
+	err := license.RequireEntitlements(ctx, "FEATURE_A", "FEATURE_B", "FEATURE_C")
+
+	var e *EntitlementsMissingError
+	if !errors.As(err, &e) || len(e.Missing) != 2 || e.Missing[0] != "FEATURE_B" || e.Missing[1] != "FEATURE_C" {
+		t.Fatalf("Should list the missing entitlements: err=%v", err)
+	}
+
+	if !errors.Is(err, ErrLicenseEntitlementsMissing) || !errors.Is(err, ErrLicenseInvalid) {
+		t.Fatalf("Should wrap the validation error: err=%v", err)
+	}
+
+	if requests != 1 {
+		t.Fatalf("Should cache the entitlements: requests=%d", requests)
+	}
+
+	codes += `,{"id":"ent-2","type":"entitlements","attributes":{"code":"FEATURE_B"}}`
+
+	if err := license.Validate(ctx); err != nil {
+		t.Fatalf("Should validate: err=%v", err)
+	}
+
+	if err := license.RequireEntitlements(ctx, "FEATURE_A", "FEATURE_B"); err != nil || requests != 2 {
+		t.Fatalf("Should refresh the entitlements on validation: requests=%d err=%v", requests, err)
+	}
+
+	gated := EntitlementMiddleware(license.RequireEntitlements, "FEATURE_B")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for code, status := range map[EntitlementCode]int{"FEATURE_B": http.StatusNoContent, "FEATURE_C": http.StatusForbidden} {
+		handler := EntitlementMiddleware(license.RequireEntitlements, code)(gated)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != status {
+			t.Fatalf("Should gate the request: code=%s status=%d", code, rec.Code)
+		}
+	}
+
+	unavailable := &License{ID: "lic-2", config: &Config{APIURL: srv.URL, LicenseKey: "key-1"}}
+	rec := httptest.NewRecorder()
+
+	EntitlementMiddleware(unavailable.RequireEntitlements, "FEATURE_A")(gated).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Should reject the request when entitlements are unavailable: status=%d", rec.Code)
+	}
+
+	dataset := &LicenseFileDataset{Entitlements: Entitlements{{Code: "FEATURE_A"}}}
+
+	if !dataset.HasEntitlement("FEATURE_A") || dataset.HasEntitlement("FEATURE_B") {
+		t.Fatalf("Should check the dataset's entitlements: dataset=%+v", dataset)
+	}
+
+	if err := dataset.RequireEntitlements("FEATURE_A", "FEATURE_B"); !errors.As(err, &e) || len(e.Missing) != 1 {
+		t.Fatalf("Should require the dataset's entitlements: err=%v", err)
+	}
+}
+
+func TestEntitlementsConcurrentValidation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/licenses/lic-1/entitlements":
+			w.Write([]byte(`{"data":[{"id":"ent-1","type":"entitlements","attributes":{"code":"FEATURE_A"}}]}`))
+		case "/v1/licenses/lic-1/actions/validate":
+			w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":true,"code":"VALID"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	license := &License{ID: "lic-1", config: &Config{APIURL: srv.URL, LicenseKey: "key-1", HTTPClient: http.DefaultClient}}
+
+	if err := license.RequireEntitlements(ctx, "FEATURE_A"); err != nil {
+		t.Fatalf("Should have the entitlement: err=%v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			errs <- license.RequireEntitlements(ctx, "FEATURE_A")
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			errs <- license.ValidateWithOptions(ctx, ValidationOptions{})
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Should check entitlements while revalidating: err=%v", err)
+		}
+	}
+}
+func TestWatcher(t *testing.T) {
+	var mu sync.Mutex
+	var codes = []string{"VALID", "VALID", "", "EXPIRED", "SUSPENDED"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/v1/licenses/lic-1/entitlements" {
+			w.Write([]byte(`{"data":[{"id":"ent-2","type":"entitlements","attributes":{"code":"FEATURE_B"}}],"links":{"next":null}}`))
+
+			return
+		}
+
+		code := "SUSPENDED"
+		if len(codes) > 0 {
+			code, codes = codes[0], codes[1:]
+		}
+
+		if code == "" {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		w.Write([]byte(`{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":false,"code":"` + code + `"}}`))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	license := &License{ID: "lic-1", config: &Config{APIURL: srv.URL, HTTPClient: http.DefaultClient}, LastValidation: &ValidationResult{Code: ValidationCodeValid}}
+	license.entitlementCache().store(Entitlements{{Code: "FEATURE_A"}})
+
+	watcher := license.Watch(ctx, WatchOptions{Interval: 5 * time.Millisecond, Jitter: time.Millisecond})
+
+	var callbacks []ValidationChange
+	watcher.OnChange(func(change ValidationChange) {
+		callbacks = append(callbacks, change)
+	})
+
+	var changes []ValidationChange
+	for change := range watcher.Changes() {
+		changes = append(changes, change)
+
+		if change.To == ValidationCodeSuspended {
+			cancel()
+		}
+	}
+
+	<-watcher.Done()
+
+	switch {
+	case len(changes) != 2:
+		t.Fatalf("Should emit each change: changes=%+v", changes)
+	case changes[0].From != ValidationCodeValid || changes[0].To != ValidationCodeExpired || changes[0].Err != ErrLicenseExpired:
+		t.Fatalf("Should emit a change to expired: change=%+v", changes[0])
+	case changes[1].From != ValidationCodeExpired || changes[1].To != ValidationCodeSuspended || changes[1].License.ID != "lic-1":
+		t.Fatalf("Should emit a change to suspended: change=%+v", changes[1])
+	case len(callbacks) != 2:
+		t.Fatalf("Should call callbacks: callbacks=%+v", callbacks)
+	case watcher.Code() != ValidationCodeSuspended || watcher.License().LastValidation.Code != ValidationCodeSuspended:
+		t.Fatalf("Should have the latest validation: code=%s", watcher.Code())
+	case watcher.Err() != context.Canceled:
+		t.Fatalf("Should stop on cancellation: err=%v", watcher.Err())
+	case license.LastValidation.Code != ValidationCodeValid:
+		t.Fatalf("Should not modify the license: license=%+v", license)
+	case license.RequireEntitlements(ctx, "FEATURE_B") != nil:
+		t.Fatalf("Should refresh the license's cached entitlements")
+	}
+
+	var errs []error
+	for err := range watcher.Errors() {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("Should emit failed validations: errs=%v", errs)
+	}
+}
+
+func TestExpiryPolicy(t *testing.T) {
+	policy := ExpiryPolicy{WarningPeriod: 7 * 24 * time.Hour, GracePeriod: 3 * 24 * time.Hour}
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		expiry := now.Add(d)
+
+		return &expiry
+	}
+
+	tests := []struct {
+		expiry *time.Time
+		status ExpiryStatus
+		days   int
+	}{
+		{nil, ExpiryStatusActive, 0},
+		{at(30 * 24 * time.Hour), ExpiryStatusActive, 30},
+		{at(36 * time.Hour), ExpiryStatusExpiring, 2},
+		{at(-36 * time.Hour), ExpiryStatusInGrace, 2},
+		{at(-4 * 24 * time.Hour), ExpiryStatusExpired, 0},
+	}
+
+	for _, tt := range tests {
+		if expiration := policy.classify(tt.expiry, now); expiration.Status != tt.status || expiration.Days() != tt.days {
+			t.Fatalf("Should classify expiry: expiry=%v status=%s days=%d", tt.expiry, expiration.Status, expiration.Days())
+		}
+	}
+
+	if expiration, err := policy.Apply(&License{Expiry: at(-time.Hour)}, ErrLicenseExpired); err != nil || expiration.Status != ExpiryStatusInGrace {
+		t.Fatalf("Should be in grace: status=%s err=%v", expiration.Status, err)
+	}
+
+	if expiration, err := policy.Apply(&License{Expiry: at(-4 * 24 * time.Hour)}, ErrLicenseExpired); err != ErrLicenseExpired || expiration.Status != ExpiryStatusExpired {
+		t.Fatalf("Should be expired after grace: status=%s err=%v", expiration.Status, err)
+	}
+
+	if _, err := (ExpiryPolicy{}).Apply(&License{Expiry: at(-time.Hour)}, ErrLicenseExpired); err != ErrLicenseExpired {
+		t.Fatalf("Should be expired without grace: err=%v", err)
+	}
+
+	if expiration, err := policy.Apply(&License{Expiry: at(time.Hour)}, ErrLicenseExpired); err != ErrLicenseExpired || expiration.Status != ExpiryStatusExpired {
+		t.Fatalf("Should not start grace when expired early: status=%s err=%v", expiration.Status, err)
+	}
+
+	if expiration, err := policy.Apply(&License{}, ErrLicenseExpired); err != ErrLicenseExpired || expiration.Status != ExpiryStatusExpired {
+		t.Fatalf("Should not start grace without an expiry: status=%s err=%v", expiration.Status, err)
+	}
+
+	// The validation's signed time is preferred over the system clock
+	signed := &License{Expiry: at(-time.Hour), LastValidation: &ValidationResult{Timestamp: *at(4 * 24 * time.Hour)}}
+	if expiration, err := policy.Apply(signed, ErrLicenseExpired); err != ErrLicenseExpired || expiration.Status != ExpiryStatusExpired {
+		t.Fatalf("Should be expired using the signed time: status=%s err=%v", expiration.Status, err)
+	}
+
+	signed = &License{Expiry: at(-4 * 24 * time.Hour), LastValidation: &ValidationResult{Timestamp: *at(-4*24*time.Hour + time.Hour)}}
+	if expiration, err := policy.Apply(signed, ErrLicenseExpired); err != nil || expiration.Status != ExpiryStatusInGrace {
+		t.Fatalf("Should be in grace using the signed time: status=%s err=%v", expiration.Status, err)
+	}
+
+	if _, err := policy.Apply(&License{Expiry: at(-time.Hour)}, ErrLicenseSuspended); err != ErrLicenseSuspended {
+		t.Fatalf("Should pass through other errors: err=%v", err)
+	}
+
+	if expiration, err := policy.Apply(nil, ErrLicenseKeyMissing); err != ErrLicenseKeyMissing || expiration.Status != "" {
+		t.Fatalf("Should pass through missing licenses: err=%v", err)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	config := &Config{PublicKey: hex.EncodeToString(publicKey), Product: "product-1", LicenseKey: "key-1"}
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	lic := &LicenseFile{Certificate: newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "EXPIRED", "expiry": "`+at(-time.Hour).Format(time.RFC3339)+`"}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	expiration, err := policy.Apply(config.ValidateOffline(OfflineOptions{LicenseFile: lic}))
+	if err != nil || expiration.Status != ExpiryStatusInGrace {
+		t.Fatalf("Should be in grace offline: status=%s err=%v", expiration.Status, err)
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	// Other tests may disable clock drift checks
+	drift := MaxClockDrift
+	MaxClockDrift = 5 * time.Minute
+	defer func() { MaxClockDrift = drift }()
+
+	config := &Config{PublicKey: hex.EncodeToString(publicKey), LicenseKey: "key-1"}
+	issued, expiry := time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	lic := &LicenseFile{Certificate: newTestCertificate(t, privateKey, "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "ACTIVE"}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)}
+
+	store := &MemoryStore{}
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: store}); err != nil {
+		t.Fatalf("Should be valid: err=%v", err)
+	}
+
+	if mark, err := loadLastSeen(store, "key-1"); err != nil || time.Since(mark) > time.Minute {
+		t.Fatalf("Should store the last seen time: mark=%v err=%v", mark, err)
+	}
+
+	// Roll the clock back, relative to the last seen time
+	if err := advanceLastSeen(store, "key-1", time.Now().Add(time.Hour), lastSeenUntrusted); err != nil {
+		t.Fatalf("Should advance the last seen time: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: store}); err != ErrSystemClockUnsynced {
+		t.Fatalf("Should detect the clock being rolled back: err=%v", err)
+	}
+
+	if err := advanceLastSeen(store, "key-1", time.Now(), lastSeenUntrusted); err != nil {
+		t.Fatalf("Should not advance the last seen time backwards: err=%v", err)
+	}
+
+	if mark, _ := loadLastSeen(store, "key-1"); time.Until(mark) < 59*time.Minute {
+		t.Fatalf("Should not move the last seen time backwards: mark=%v", mark)
+	}
+
+	// A signed time may be replayed, so it can't move the mark backwards
+	if err := advanceLastSeen(store, "key-1", time.Now(), lastSeenSigned); err != nil {
+		t.Fatalf("Should not replace the last seen time: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: store}); err != ErrSystemClockUnsynced {
+		t.Fatalf("Should not recover using a signed time: err=%v", err)
+	}
+
+	// A nonce-verified time recovers from a system clock that was ahead
+	if err := advanceLastSeen(store, "key-1", time.Now(), lastSeenVerified); err != nil {
+		t.Fatalf("Should replace the last seen time: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: store}); err != nil {
+		t.Fatalf("Should be valid after a verified time: err=%v", err)
+	}
+
+	// A missing mark alongside cached files may have been deleted
+	cached := &MemoryStore{}
+	cached.SaveLicenseFile(lic)
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: cached}); err != ErrSystemClockUnsynced {
+		t.Fatalf("Should reject a missing last seen time with cached files: err=%v", err)
+	}
+
+	tampered := &MemoryStore{}
+	tampered.SaveLastSeen([]byte(`{"time":"2020-01-01T00:00:00Z","mac":"AAAA"}`))
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: tampered}); err != ErrSystemClockUnsynced {
+		t.Fatalf("Should reject a tampered last seen time: err=%v", err)
+	}
+
+	if _, err := (&Config{PublicKey: config.PublicKey, LicenseKey: "key-2"}).ValidateOffline(OfflineOptions{LicenseFile: lic, LastSeen: store}); err != ErrSystemClockUnsynced {
+		t.Fatalf("Should reject a last seen time for another license key: err=%v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/me":
+			writeTestSignedResponse(w, r, privateKey, `{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}}}`)
+		case "/v1/licenses/lic-1/actions/validate":
+			var params struct {
+				Meta struct {
+					Nonce int64 `json:"nonce"`
+				} `json:"meta"`
+			}
+
+			json.NewDecoder(r.Body).Decode(&params)
+
+			writeTestSignedResponse(w, r, privateKey, `{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}},"meta":{"valid":true,"code":"VALID","nonce":`+strconv.FormatInt(params.Meta.Nonce, 10)+`}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	online := &Config{APIURL: srv.URL, PublicKey: config.PublicKey, LicenseKey: "key-1", HTTPClient: http.DefaultClient}
+
+	// Replace an invalid mark using the API's signed time
+	fileStore := &FileStore{Dir: dir, LicenseKey: "key-1"}
+	fileStore.SaveLastSeen([]byte(`{}`))
+
+	license, err := online.ValidateHybrid(context.Background(), HybridOptions{Store: fileStore})
+	if err != nil {
+		t.Fatalf("Should validate online: err=%v", err)
+	}
+
+	if license.LastValidation.Timestamp.IsZero() {
+		t.Fatalf("Should have a signed timestamp: result=%v", license.LastValidation)
+	}
+
+	if err := fileStore.Clear(); err != nil {
+		t.Fatalf("Should clear the store: err=%v", err)
+	}
+
+	mark, err := loadLastSeen(&FileStore{Dir: dir, LicenseKey: "key-1"}, "key-1")
+	if err != nil || !mark.Equal(license.LastValidation.Timestamp) {
+		t.Fatalf("Should persist the API's signed time: mark=%v timestamp=%v err=%v", mark, license.LastValidation.Timestamp, err)
+	}
+
+	// Only a nonce-verified time moves the mark backwards
+	ahead := time.Now().Add(time.Hour).UTC()
+	if err := advanceLastSeen(fileStore, "key-1", ahead, lastSeenUntrusted); err != nil {
+		t.Fatalf("Should advance the last seen time: err=%v", err)
+	}
+
+	if _, err := online.ValidateHybrid(context.Background(), HybridOptions{Store: fileStore}); err != nil {
+		t.Fatalf("Should validate online: err=%v", err)
+	}
+
+	if mark, _ := loadLastSeen(fileStore, "key-1"); !mark.Equal(ahead) {
+		t.Fatalf("Should not lower the last seen time without a nonce: mark=%v", mark)
+	}
+
+	license, err = online.ValidateHybrid(context.Background(), HybridOptions{Store: fileStore, Nonce: true})
+	if err != nil {
+		t.Fatalf("Should validate online with a nonce: err=%v", err)
+	}
+
+	if mark, _ := loadLastSeen(fileStore, "key-1"); !mark.Equal(license.LastValidation.Timestamp) {
+		t.Fatalf("Should lower the last seen time using a verified time: mark=%v timestamp=%v", mark, license.LastValidation.Timestamp)
+	}
+}
+
+// testClock is a fake Clock whose time only moves when advanced.
+type testClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*testTimer
+}
+
+type testTimer struct {
+	clock  *testClock
+	c      chan time.Time
+	at     time.Time
+	active bool
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &testTimer{clock: c, c: make(chan time.Time, 1), at: c.now.Add(d), active: true}
+	c.timers = append(c.timers, timer)
+
+	return timer
+}
+
+// Advance moves the clock forward, firing any timers that are due.
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	for _, timer := range c.timers {
+		if timer.active && !timer.at.After(c.now) {
+			timer.active = false
+			timer.c <- c.now
+		}
+	}
+}
+
+// waitForTimers waits until n timers are active, e.g. until a goroutine is
+// waiting on its next tick.
+func (c *testClock) waitForTimers(t *testing.T, n int) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; runtime.Gosched() {
+		c.mu.Lock()
+		active := 0
+		for _, timer := range c.timers {
+			if timer.active {
+				active++
+			}
+		}
+		c.mu.Unlock()
+
+		if active >= n {
+			return
+		}
+	}
+
+	t.Fatalf("Should wait for timers: n=%d", n)
+}
+
+func (t *testTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *testTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.active
+	t.active = false
+
+	return active
+}
+
+func (t *testTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.active
+	t.at, t.active = t.clock.now.Add(d), true
+
+	return active
+}
+
+func TestClock(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Should generate keypair: err=%v", err)
+	}
+
+	// Other tests may disable clock drift checks
+	drift := MaxClockDrift
+	MaxClockDrift = 5 * time.Minute
+	defer func() { MaxClockDrift = drift }()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	issued, expiry := now.Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)
+
+	sign := func(msg []byte) []byte { return ed25519.Sign(privateKey, msg) }
+	cert := newTestCertificateWithAlg(t, sign, "base64+ed25519", "license", "key-1", `{
+		"data": {"id": "lic-1", "type": "licenses", "attributes": {"key": "key-1", "status": "ACTIVE", "expiry": "`+expiry+`"}},
+		"meta": {"issued": "`+issued+`", "expiry": "`+expiry+`", "ttl": 3600}
+	}`)
+
+	clock := &testClock{now: now}
+	config := &Config{PublicKey: hex.EncodeToString(publicKey), LicenseKey: "key-1", Clock: clock}
+	lic := &LicenseFile{Certificate: cert, config: config}
+
+	if _, err := lic.Decode(); err != nil {
+		t.Fatalf("Should be valid: err=%v", err)
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	if _, err := lic.Decode(); err != ErrLicenseFileExpired {
+		t.Fatalf("Should be expired using the config's clock: err=%v", err)
+	}
+
+	if _, err := config.ValidateOffline(OfflineOptions{LicenseFile: lic}); err != ErrLicenseFileExpired {
+		t.Fatalf("Should be expired offline using the config's clock: err=%v", err)
+	}
+
+	clock.Advance(-3 * time.Hour)
+
+	if _, err := lic.Decode(); err != ErrSystemClockUnsynced {
+		t.Fatalf("Should detect a clock behind the issued time: err=%v", err)
+	}
+
+	if expiration, _ := (ExpiryPolicy{WarningPeriod: 24 * time.Hour}).Apply(&License{Expiry: &now, config: config}, nil); expiration.Remaining != time.Hour {
+		t.Fatalf("Should classify expiry using the config's clock: remaining=%s", expiration.Remaining)
+	}
+
+	// Global clock
+	DefaultClock = &testClock{now: now.Add(2 * time.Hour)}
+	defer func() { DefaultClock = SystemClock{} }()
+
+	if _, err := (&LicenseFile{Certificate: cert, config: &Config{PublicKey: config.PublicKey}}).Decode(); err != ErrLicenseFileExpired {
+		t.Fatalf("Should be expired using the default clock: err=%v", err)
+	}
+
+	if !(KeyClaims{Expiry: &now}).Expired() {
+		t.Fatalf("Should be expired using the default clock")
+	}
+
+	DefaultClock = SystemClock{}
+
+	// Drifted responses
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeTestSignedResponse(w, r, privateKey, `{"data":{"id":"lic-1","type":"licenses","attributes":{"key":"key-1"}}}`)
+	}))
+	defer srv.Close()
+
+	drifted := &testClock{now: time.Now().Add(time.Hour)}
+	online := &Config{APIURL: srv.URL, PublicKey: config.PublicKey, LicenseKey: "key-1", Clock: drifted}
+
+	if _, err := online.NewClient().Get(context.Background(), "me", nil, &License{}); err != ErrResponseDateTooOld {
+		t.Fatalf("Should reject a drifted response using the config's clock: err=%v", err)
+	}
+
+	online.Clock = nil
+
+	if _, err := online.NewClient().Get(context.Background(), "me", nil, &License{}); err != nil {
+		t.Fatalf("Should accept a response using the default clock: err=%v", err)
+	}
+
+	// Heartbeat timing
+	var mu sync.Mutex
+	pings := make(chan struct{}, 16)
+	fail := false
+
+	clock = &testClock{now: now}
+	heartbeat := newHeartbeat(func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		pings <- struct{}{}
+		if fail {
+			return errors.New("network error")
+		}
+
+		return nil
+	}, 10*time.Minute, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	heartbeat.start(ctx)
+
+	clock.waitForTimers(t, 1)
+	clock.Advance(9 * time.Minute)
+
+	select {
+	case <-pings:
+		t.Fatalf("Should not ping before the interval")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	<-pings
+
+	clock.waitForTimers(t, 1)
+
+	if last := heartbeat.LastPing(); !last.Equal(now.Add(10 * time.Minute)) {
+		t.Fatalf("Should track the last ping using the clock: last=%v", last)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+
+	clock.Advance(10 * time.Minute)
+	<-pings
+
+	if err := <-heartbeat.Errors(); !errors.Is(err, ErrHeartbeatPingFailed) {
+		t.Fatalf("Should emit a failed ping: err=%v", err)
+	}
+
+	// Retried after the backoff, until the heartbeat window has passed
+	clock.waitForTimers(t, 1)
+	clock.Advance(heartbeatMinBackoff)
+	<-pings
+	<-heartbeat.Done()
+
+	if err := heartbeat.Err(); err != ErrHeartbeatExpired {
+		t.Fatalf("Should stop once the heartbeat window has passed: err=%v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package keygen
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+)
+
+// LastSeenStore is implemented by stores that persist a high-water mark of the
+// latest time seen, used to detect the system clock being rolled back between
+// runs, e.g. to keep using an expired offline license. The mark is signed with
+// a key derived from the license key, so stores only need to persist it as-is.
+// LoadLastSeen returns ErrStoredFileNotFound when no mark has been saved.
+//
+// Both FileStore and MemoryStore implement LastSeenStore.
+type LastSeenStore interface {
+	LoadLastSeen() ([]byte, error)
+	SaveLastSeen(mark []byte) error
+}
+
+// lastSeenTrust is how much a time used to advance the mark can be trusted.
+type lastSeenTrust int
+
+const (
+	// lastSeenUntrusted is e.g. the system time, which may have been changed.
+	lastSeenUntrusted lastSeenTrust = iota
+
+	// lastSeenSigned is a signed response's time, which is genuine but may be
+	// from an old response being replayed.
+	lastSeenSigned
+
+	// lastSeenVerified is a signed response's time that echoed a nonce, so it
+	// can't be from an old response.
+	lastSeenVerified
+)
+
+type lastSeen struct {
+	Time time.Time `json:"time"`
+	MAC  []byte    `json:"mac"`
+}
+
+// lastSeenMAC signs a mark's time using a key derived from the license key, so
+// that a mark can't be forged or reused for another license.
+func lastSeenMAC(key string, t time.Time) []byte {
+	k := sha256.Sum256([]byte("keygen-last-seen:" + key))
+
+	mac := hmac.New(sha256.New, k[:])
+	mac.Write([]byte(t.UTC().Format(time.RFC3339Nano)))
+
+	return mac.Sum(nil)
+}
+
+// loadLastSeen returns the stored mark, or the zero time when there is none.
+// It returns ErrStoredFileInvalid when the mark has been tampered with.
+func loadLastSeen(store LastSeenStore, key string) (time.Time, error) {
+	data, err := store.LoadLastSeen()
+	switch {
+	case err == ErrStoredFileNotFound:
+		return time.Time{}, nil
+	case err != nil:
+		return time.Time{}, err
+	}
+
+	var mark lastSeen
+	if err := json.Unmarshal(data, &mark); err != nil {
+		return time.Time{}, ErrStoredFileInvalid
+	}
+
+	if !hmac.Equal(mark.MAC, lastSeenMAC(key, mark.Time)) {
+		return time.Time{}, ErrStoredFileInvalid
+	}
+
+	return mark.Time, nil
+}
+
+// checkLastSeen returns ErrSystemClockUnsynced when the current time is before
+// the stored mark by more than MaxClockDrift, or when the mark is invalid. When
+// the store has cached files, a missing mark is also considered unsynced, since
+// it may have been deleted to reset the mark.
+func checkLastSeen(store LastSeenStore, key string, now time.Time) error {
+	t, err := loadLastSeen(store, key)
+	switch {
+	case err == ErrStoredFileInvalid:
+		return ErrSystemClockUnsynced
+	case err != nil:
+		return err
+	case t.IsZero() && hasCachedFiles(store):
+		return ErrSystemClockUnsynced
+	}
+
+	if MaxClockDrift >= 0 && t.Sub(now) > MaxClockDrift {
+		return ErrSystemClockUnsynced
+	}
+
+	return nil
+}
+
+// advanceLastSeen moves the stored mark forward to t, e.g. to the system time.
+// The mark is never moved backwards, unless t is from a nonce-verified response,
+// so that a mark set by a system clock that was ahead can be recovered without
+// a replayed response lowering it. A signed time also replaces an invalid mark,
+// e.g. a mark for a previous license key.
+func advanceLastSeen(store LastSeenStore, key string, t time.Time, trust lastSeenTrust) error {
+	prev, err := loadLastSeen(store, key)
+	switch {
+	case trust == lastSeenVerified:
+		// noop
+	case err == ErrStoredFileInvalid && trust == lastSeenSigned:
+		// noop
+	case err != nil:
+		return err
+	case !t.After(prev):
+		return nil
+	}
+
+	data, err := json.Marshal(lastSeen{Time: t, MAC: lastSeenMAC(key, t)})
+	if err != nil {
+		return err
+	}
+
+	return store.SaveLastSeen(data)
+}
+
+// hasCachedFiles reports whether the store also has cached license or machine
+// files, e.g. a FileStore used for hybrid validation.
+func hasCachedFiles(store LastSeenStore) bool {
+	s, ok := store.(Store)
+	if !ok {
+		return false
+	}
+
+	if _, err := s.LoadLicenseFile(); err == nil {
+		return true
+	}
+
+	_, err := s.LoadMachineFile()
+
+	return err == nil
+}
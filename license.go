@@ -2,8 +2,10 @@ package keygen
 
 import (
 	"context"
+	"errors"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/keygen-sh/jsonapi-go"
@@ -12,7 +14,21 @@ import (
 type SchemeCode string
 
 const (
-	SchemeCodeEd25519 SchemeCode = "ED25519_SIGN"
+	SchemeCodeEd25519               SchemeCode = "ED25519_SIGN"
+	SchemeCodeRSA2048PKCS1SignV2    SchemeCode = "RSA_2048_PKCS1_SIGN_V2"
+	SchemeCodeRSA2048PKCS1PSSSignV2 SchemeCode = "RSA_2048_PKCS1_PSS_SIGN_V2"
+	SchemeCodeRSA2048JWTRS256       SchemeCode = "RSA_2048_JWT_RS256"
+)
+
+type LicenseStatusCode string
+
+const (
+	LicenseStatusCodeActive    LicenseStatusCode = "ACTIVE"
+	LicenseStatusCodeInactive  LicenseStatusCode = "INACTIVE"
+	LicenseStatusCodeExpiring  LicenseStatusCode = "EXPIRING"
+	LicenseStatusCodeExpired   LicenseStatusCode = "EXPIRED"
+	LicenseStatusCodeSuspended LicenseStatusCode = "SUSPENDED"
+	LicenseStatusCodeBanned    LicenseStatusCode = "BANNED"
 )
 
 // License represents a Keygen license object.
@@ -23,13 +39,46 @@ type License struct {
 	Key              string                 `json:"key"`
 	Expiry           *time.Time             `json:"expiry"`
 	Scheme           SchemeCode             `json:"scheme"`
+	Status           LicenseStatusCode      `json:"status"`
 	RequireHeartbeat bool                   `json:"requireHeartbeat"`
 	LastValidated    *time.Time             `json:"lastValidated"`
 	Created          time.Time              `json:"created"`
 	Updated          time.Time              `json:"updated"`
 	Metadata         map[string]interface{} `json:"metadata"`
 	PolicyId         string                 `json:"-"`
+	ProductID        string                 `json:"-"`
+	UserID           string                 `json:"-"`
+	GroupID          string                 `json:"-"`
 	LastValidation   *ValidationResult      `json:"-"`
+
+	config       *Config           `json:"-"`
+	entitlements *entitlementCache `json:"-"`
+}
+
+// entitlementCache caches a license's entitlements. It's shared by copies of
+// the license, and survives revalidation, so that it can be read while the
+// license is being revalidated.
+type entitlementCache struct {
+	mu           sync.RWMutex
+	entitlements Entitlements
+	loaded       bool
+}
+
+// entitlementCacheMu guards the lazy initialization of license caches.
+var entitlementCacheMu sync.Mutex
+
+func (c *entitlementCache) load() (Entitlements, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.entitlements, c.loaded
+}
+
+func (c *entitlementCache) store(entitlements Entitlements) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entitlements, c.loaded = entitlements, true
 }
 
 // SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
@@ -55,6 +104,23 @@ func (l *License) SetRelationships(relationships map[string]interface{}) error {
 		l.PolicyId = relationship.(*jsonapi.ResourceObjectIdentifier).ID
 	}
 
+	if relationship, ok := relationships["product"]; ok {
+		l.ProductID = relationship.(*jsonapi.ResourceObjectIdentifier).ID
+	}
+
+	// Newer API versions call the license's user its owner
+	if relationship, ok := relationships["user"]; ok {
+		l.UserID = relationship.(*jsonapi.ResourceObjectIdentifier).ID
+	}
+
+	if relationship, ok := relationships["owner"]; ok {
+		l.UserID = relationship.(*jsonapi.ResourceObjectIdentifier).ID
+	}
+
+	if relationship, ok := relationships["group"]; ok {
+		l.GroupID = relationship.(*jsonapi.ResourceObjectIdentifier).ID
+	}
+
 	return nil
 }
 
@@ -63,22 +129,24 @@ func (l *License) SetRelationships(relationships map[string]interface{}) error {
 // if the license is invalid, e.g. ErrLicenseNotActivated, ErrLicenseExpired or
 // ErrLicenseTooManyMachines.
 func (l *License) Validate(ctx context.Context, fingerprints ...string) error {
-	client := NewClient()
+	return l.ValidateWithOptions(ctx, ValidationOptions{}, fingerprints...)
+}
+
+// ValidateWithOptions performs a license validation like Validate, additionally
+// scoped to the options, e.g. a policy, machine, user or required entitlements.
+// The validation's result and scope are stored in LastValidation.
+func (l *License) ValidateWithOptions(ctx context.Context, options ValidationOptions, fingerprints ...string) error {
+	cfg := l.config.resolve()
+	client := l.config.NewClient()
 	validation := &validation{}
 
-	// split up fingerprints (first is machine, rest are components)
-	var params validate
-	if n := len(fingerprints); n > 0 {
-		if n > 1 {
-			params = validate{fingerprint: fingerprints[0], components: fingerprints[1:]}
-		} else {
-			params = validate{fingerprint: fingerprints[0]}
-		}
-	} else {
-		params = validate{}
+	params, err := newValidate(cfg, options, fingerprints...)
+	if err != nil {
+		return err
 	}
 
-	if _, err := client.Post(ctx, "licenses/"+l.ID+"/actions/validate", params, validation); err != nil {
+	res, err := client.Post(ctx, "licenses/"+l.ID+"/actions/validate", params, validation)
+	if err != nil {
 		if _, ok := err.(*NotFoundError); ok {
 			return ErrLicenseInvalid
 		}
@@ -86,48 +154,46 @@ func (l *License) Validate(ctx context.Context, fingerprints ...string) error {
 		return err
 	}
 
-	*l = validation.License
+	if err := params.verify(validation.Result); err != nil {
+		return err
+	}
+
+	_, cached := l.entitlementCache().load()
+	l.update(&validation.License)
 
 	// Store last validation result
+	validation.Result.Source = ValidationSourceNetwork
+	validation.Result.Timestamp = signedDate(client, res)
 	l.LastValidation = &validation.Result
 
-	if validation.Result.Code == ValidationCodeValid {
-		return nil
-	}
-
-	switch {
-	case validation.Result.Code == ValidationCodeFingerprintScopeMismatch ||
-		validation.Result.Code == ValidationCodeNoMachines ||
-		validation.Result.Code == ValidationCodeNoMachine:
-		return ErrLicenseNotActivated
-	case validation.Result.Code == ValidationCodeExpired:
-		return ErrLicenseExpired
-	case validation.Result.Code == ValidationCodeSuspended:
-		return ErrLicenseSuspended
-	case validation.Result.Code == ValidationCodeTooManyMachines:
-		return ErrLicenseTooManyMachines
-	case validation.Result.Code == ValidationCodeTooManyCores:
-		return ErrLicenseTooManyCores
-	case validation.Result.Code == ValidationCodeTooManyProcesses:
-		return ErrLicenseTooManyProcesses
-	case validation.Result.Code == ValidationCodeFingerprintScopeRequired ||
-		validation.Result.Code == ValidationCodeFingerprintScopeEmpty:
-		return ErrValidationFingerprintMissing
-	case validation.Result.Code == ValidationCodeComponentsScopeRequired ||
-		validation.Result.Code == ValidationCodeComponentsScopeEmpty:
-		return ErrValidationComponentsMissing
-	case validation.Result.Code == ValidationCodeComponentsScopeMismatch:
-		return ErrComponentNotActivated
-	case validation.Result.Code == ValidationCodeHeartbeatNotStarted:
-		return ErrHeartbeatRequired
-	case validation.Result.Code == ValidationCodeHeartbeatDead:
-		return ErrHeartbeatDead
-	case validation.Result.Code == ValidationCodeProductScopeRequired ||
-		validation.Result.Code == ValidationCodeProductScopeEmpty:
-		return ErrValidationProductMissing
-	default:
-		return ErrLicenseInvalid
+	// Refresh any cached entitlements, since they may have changed
+	if cached {
+		if _, err := l.refreshEntitlements(ctx); err != nil {
+			Logger.Warnf("Error refreshing entitlements: license_id=%s err=%v", l.ID, err)
+		}
 	}
+
+	return validationError(validation.Result.Code)
+}
+
+// update copies a validated license's attributes onto the license. Its ID,
+// config and entitlement cache are kept, so that they can be read while the
+// license is being revalidated.
+func (l *License) update(license *License) {
+	l.Name = license.Name
+	l.Key = license.Key
+	l.Expiry = license.Expiry
+	l.Scheme = license.Scheme
+	l.Status = license.Status
+	l.RequireHeartbeat = license.RequireHeartbeat
+	l.LastValidated = license.LastValidated
+	l.Created = license.Created
+	l.Updated = license.Updated
+	l.Metadata = license.Metadata
+	l.PolicyId = license.PolicyId
+	l.ProductID = license.ProductID
+	l.UserID = license.UserID
+	l.GroupID = license.GroupID
 }
 
 // Verify checks if the license's key is genuine by cryptographically verifying the
@@ -139,17 +205,31 @@ func (l *License) Verify() ([]byte, error) {
 		return nil, ErrLicenseNotSigned
 	}
 
-	verifier := &verifier{PublicKey: PublicKey}
+	cfg := l.config.resolve()
+	verifier := &verifier{PublicKey: cfg.PublicKey, RSAPublicKey: cfg.RSAPublicKey}
 
 	return verifier.VerifyLicense(l)
 }
 
+// VerifyDataset verifies the license's key like Verify, and unmarshals the key's
+// JSON dataset into v, e.g. a struct embedding KeyClaims. An error will be
+// returned if the license is not genuine, or if the dataset is not valid JSON,
+// e.g. ErrLicenseKeyNotGenuine or ErrLicenseKeyDatasetInvalid.
+func (l *License) VerifyDataset(v interface{}) error {
+	dataset, err := l.Verify()
+	if err != nil {
+		return err
+	}
+
+	return unmarshalKeyDataset(dataset, v)
+}
+
 // Activate performs a machine activation for the license, identified by the provided
 // fingerprint. If the activation is successful, the new machine will be returned. An
 // error will be returned if the activation fails, e.g. ErrMachineLimitExceeded
 // or ErrMachineAlreadyActivated.
 func (l *License) Activate(ctx context.Context, fingerprint string, components ...Component) (*Machine, error) {
-	client := NewClient()
+	client := l.config.NewClient()
 	hostname, _ := os.Hostname()
 	params := &Machine{
 		Fingerprint: fingerprint,
@@ -160,7 +240,7 @@ func (l *License) Activate(ctx context.Context, fingerprint string, components .
 		components:  components,
 	}
 
-	machine := &Machine{}
+	machine := &Machine{config: l.config}
 	if _, err := client.Post(ctx, "machines", params, machine); err != nil {
 		return nil, err
 	}
@@ -172,7 +252,7 @@ func (l *License) Activate(ctx context.Context, fingerprint string, components .
 // can be the machine's UUID or the machine's fingerprint. An error will be returned
 // if the machine deactivation fails.
 func (l *License) Deactivate(ctx context.Context, id string) error {
-	client := NewClient()
+	client := l.config.NewClient()
 
 	_, err := client.Delete(ctx, "machines/"+id, nil, nil)
 	if err != nil {
@@ -185,8 +265,8 @@ func (l *License) Deactivate(ctx context.Context, id string) error {
 // Machine retreives a machine, identified by the provided ID. The ID can be the machine's
 // UUID or the machine's fingerprint. An error will be returned if it does not exist.
 func (l *License) Machine(ctx context.Context, id string) (*Machine, error) {
-	client := NewClient()
-	machine := &Machine{}
+	client := l.config.NewClient()
+	machine := &Machine{config: l.config}
 
 	if _, err := client.Get(ctx, "machines/"+id, nil, machine); err != nil {
 		return nil, err
@@ -195,21 +275,51 @@ func (l *License) Machine(ctx context.Context, id string) (*Machine, error) {
 	return machine, nil
 }
 
-// Machines lists up to 100 machines for the license.
+// Machines lists up to 100 machines for the license. See AllMachines to list
+// every machine.
 func (l *License) Machines(ctx context.Context) (Machines, error) {
-	client := NewClient()
+	client := l.config.NewClient()
 	machines := Machines{}
 
 	if _, err := client.Get(ctx, "licenses/"+l.ID+"/machines", querystring{Limit: 100}, &machines); err != nil {
 		return nil, err
 	}
 
+	for i := range machines {
+		machines[i].config = l.config
+	}
+
+	return machines, nil
+}
+
+// IterateMachines returns an iterator over all machines for the license, which
+// requests additional pages as needed.
+func (l *License) IterateMachines(ctx context.Context) *MachineIterator {
+	pager := newPager(l.config.NewClient(), "licenses/"+l.ID+"/machines")
+
+	return &MachineIterator{iterator: newIterator(ctx, pager), config: l.config}
+}
+
+// AllMachines lists all machines for the license, requesting every page.
+func (l *License) AllMachines(ctx context.Context) (Machines, error) {
+	machines := Machines{}
+
+	it := l.IterateMachines(ctx)
+	for it.Next() {
+		machines = append(machines, *it.Machine())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
 	return machines, nil
 }
 
-// Machines lists up to 100 entitlements for the license.
+// Entitlements lists up to 100 entitlements for the license. See AllEntitlements
+// to list every entitlement.
 func (l *License) Entitlements(ctx context.Context) (Entitlements, error) {
-	client := NewClient()
+	client := l.config.NewClient()
 	entitlements := Entitlements{}
 
 	if _, err := client.Get(ctx, "licenses/"+l.ID+"/entitlements", querystring{Limit: 100}, &entitlements); err != nil {
@@ -219,10 +329,91 @@ func (l *License) Entitlements(ctx context.Context) (Entitlements, error) {
 	return entitlements, nil
 }
 
+// HasEntitlement reports whether the license has the entitlement. The license's
+// entitlements are requested on first use and cached, and the cache is refreshed
+// on each validation. It returns an error if the entitlements can't be requested.
+func (l *License) HasEntitlement(ctx context.Context, code EntitlementCode) (bool, error) {
+	err := l.RequireEntitlements(ctx, code)
+
+	var e *EntitlementsMissingError
+	if errors.As(err, &e) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// RequireEntitlements checks that the license has every entitlement, using the
+// cached entitlements (see HasEntitlement). It returns an EntitlementsMissingError
+// listing any missing codes, or an error if the entitlements can't be requested.
+// It's safe to call concurrently, e.g. from an HTTP handler, including while the
+// license is being revalidated.
+func (l *License) RequireEntitlements(ctx context.Context, codes ...EntitlementCode) error {
+	entitlements, ok := l.entitlementCache().load()
+	if !ok {
+		var err error
+
+		if entitlements, err = l.refreshEntitlements(ctx); err != nil {
+			return err
+		}
+	}
+
+	return entitlements.Require(codes...)
+}
+
+// refreshEntitlements requests all of the license's entitlements and caches them.
+func (l *License) refreshEntitlements(ctx context.Context) (Entitlements, error) {
+	entitlements, err := l.AllEntitlements(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l.entitlementCache().store(entitlements)
+
+	return entitlements, nil
+}
+
+// entitlementCache returns the license's entitlement cache, creating it on
+// first use.
+func (l *License) entitlementCache() *entitlementCache {
+	entitlementCacheMu.Lock()
+	defer entitlementCacheMu.Unlock()
+
+	if l.entitlements == nil {
+		l.entitlements = &entitlementCache{}
+	}
+
+	return l.entitlements
+}
+
+// IterateEntitlements returns an iterator over all entitlements for the license,
+// which requests additional pages as needed.
+func (l *License) IterateEntitlements(ctx context.Context) *EntitlementIterator {
+	pager := newPager(l.config.NewClient(), "licenses/"+l.ID+"/entitlements")
+
+	return &EntitlementIterator{iterator: newIterator(ctx, pager)}
+}
+
+// AllEntitlements lists all entitlements for the license, requesting every page.
+func (l *License) AllEntitlements(ctx context.Context) (Entitlements, error) {
+	entitlements := Entitlements{}
+
+	it := l.IterateEntitlements(ctx)
+	for it.Next() {
+		entitlements = append(entitlements, *it.Entitlement())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return entitlements, nil
+}
+
 // Checkout generates an encrypted license file. Returns a LicenseFile.
 func (l *License) Checkout(ctx context.Context, options ...CheckoutOption) (*LicenseFile, error) {
-	client := NewClient()
-	lic := &LicenseFile{}
+	client := l.config.NewClient()
+	lic := &LicenseFile{config: l.config}
 
 	opts := CheckoutOptions{Encrypt: true, Include: "entitlements"}
 	for _, opt := range options {
@@ -3,6 +3,8 @@ package keygen
 import (
 	"encoding/base64"
 	"encoding/json"
+	"io"
+	"os"
 	"strings"
 	"time"
 
@@ -18,6 +20,40 @@ type LicenseFile struct {
 	Expiry      time.Time `json:"expiry"`
 	TTL         int       `json:"ttl"`
 	LicenseID   string    `json:"-"`
+
+	config *Config `json:"-"`
+}
+
+// ParseLicenseFile parses a license file from its certificate, e.g. the contents
+// of a .lic file, or a raw certificate without armor. It returns an error if
+// the certificate is malformed, e.g. an ArmorError for a machine file.
+func ParseLicenseFile(cert string) (*LicenseFile, error) {
+	lic := &LicenseFile{Certificate: armor(cert)}
+	if _, err := lic.certificate(); err != nil {
+		return nil, err
+	}
+
+	return lic, nil
+}
+
+// ReadLicenseFile reads and parses a license file. See ParseLicenseFile.
+func ReadLicenseFile(r io.Reader) (*LicenseFile, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseLicenseFile(string(b))
+}
+
+// LoadLicenseFile reads and parses a license file from a path. See ParseLicenseFile.
+func LoadLicenseFile(path string) (*LicenseFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseLicenseFile(string(b))
 }
 
 // SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
@@ -49,7 +85,8 @@ func (lic *LicenseFile) SetRelationships(relationships map[string]interface{}) e
 // Decrypt verifies the license file's signature. It returns any errors
 // that occurred during verification, e.g. ErrLicenseFileInvalid.
 func (lic *LicenseFile) Verify() error {
-	verifier := &verifier{PublicKey: PublicKey}
+	cfg := lic.config.resolve()
+	verifier := &verifier{PublicKey: cfg.PublicKey, RSAPublicKey: cfg.RSAPublicKey}
 
 	if err := verifier.VerifyLicenseFile(lic); err != nil {
 		return &LicenseFileError{err}
@@ -67,10 +104,12 @@ func (lic *LicenseFile) Decrypt(key string) (*LicenseFileDataset, error) {
 	}
 
 	switch {
-	case cert.Alg == "aes-256-gcm+rsa-pss-sha256" || cert.Alg == "aes-256-gcm+rsa-sha256":
-		return nil, ErrLicenseFileNotSupported
-	case cert.Alg != "aes-256-gcm+ed25519":
+	case cert.Alg == "aes-256-gcm+ed25519" || cert.Alg == "aes-256-gcm+rsa-pss-sha256" || cert.Alg == "aes-256-gcm+rsa-sha256":
+		// noop
+	case strings.HasPrefix(cert.Alg, "base64+"):
 		return nil, ErrLicenseFileNotEncrypted
+	default:
+		return nil, ErrLicenseFileNotSupported
 	}
 
 	// Decrypt
@@ -80,6 +119,46 @@ func (lic *LicenseFile) Decrypt(key string) (*LicenseFileDataset, error) {
 		return nil, &LicenseFileError{err}
 	}
 
+	return lic.dataset(data)
+}
+
+// Decode verifies and decodes the license file's unencrypted dataset, i.e. a license file
+// checked out using CheckoutEncrypt(false). It returns the decoded dataset and any errors
+// that occurred during verification or decoding, e.g. ErrLicenseFileNotGenuine or
+// ErrLicenseFileEncrypted.
+func (lic *LicenseFile) Decode() (*LicenseFileDataset, error) {
+	cert, err := lic.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(cert.Alg, "base64+") {
+		return nil, ErrLicenseFileEncrypted
+	}
+
+	if err := lic.Verify(); err != nil {
+		return nil, err
+	}
+
+	// Decode
+	data, err := base64.StdEncoding.DecodeString(cert.Enc)
+	if err != nil {
+		return nil, &LicenseFileError{err}
+	}
+
+	return lic.dataset(data)
+}
+
+// open decrypts or decodes the license file's dataset, depending on whether it's encrypted.
+func (lic *LicenseFile) open(key string) (*LicenseFileDataset, error) {
+	if cert, err := lic.certificate(); err == nil && strings.HasPrefix(cert.Alg, "base64+") {
+		return lic.Decode()
+	}
+
+	return lic.Decrypt(key)
+}
+
+func (lic *LicenseFile) dataset(data []byte) (*LicenseFileDataset, error) {
 	// Unmarshal
 	dataset := &LicenseFileDataset{}
 
@@ -87,11 +166,14 @@ func (lic *LicenseFile) Decrypt(key string) (*LicenseFileDataset, error) {
 		return nil, err
 	}
 
-	if MaxClockDrift >= 0 && time.Until(dataset.Issued) > MaxClockDrift {
+	dataset.License.config = lic.config
+
+	now := lic.config.clock().Now()
+	if MaxClockDrift >= 0 && dataset.Issued.Sub(now) > MaxClockDrift {
 		return dataset, ErrSystemClockUnsynced
 	}
 
-	if dataset.TTL != 0 && time.Now().After(dataset.Expiry) {
+	if dataset.TTL != 0 && now.After(dataset.Expiry) {
 		return dataset, ErrLicenseFileExpired
 	}
 
@@ -99,11 +181,11 @@ func (lic *LicenseFile) Decrypt(key string) (*LicenseFileDataset, error) {
 }
 
 func (lic *LicenseFile) certificate() (*certificate, error) {
-	payload := lic.Certificate
-
 	// Remove header and footer
-	payload = strings.TrimPrefix(payload, "-----BEGIN LICENSE FILE-----\n")
-	payload = strings.TrimSuffix(payload, "-----END LICENSE FILE-----\n")
+	payload, err := unarmor(lic.Certificate, licenseFileLabel)
+	if err != nil {
+		return nil, &LicenseFileError{err}
+	}
 
 	// Decode
 	dec, err := base64.StdEncoding.DecodeString(payload)
@@ -122,11 +204,26 @@ func (lic *LicenseFile) certificate() (*certificate, error) {
 
 // LicenseFileDataset represents a decrypted license file object.
 type LicenseFileDataset struct {
-	License      License      `json:"-"`
-	Entitlements Entitlements `json:"-"`
-	Issued       time.Time    `json:"issued"`
-	Expiry       time.Time    `json:"expiry"`
-	TTL          int          `json:"ttl"`
+	License      License         `json:"-"`
+	Entitlements Entitlements    `json:"-"`
+	Policy       *Policy         `json:"-"`
+	User         *User           `json:"-"`
+	Product      *ProductDetails `json:"-"`
+	Group        *Group          `json:"-"`
+	Issued       time.Time       `json:"issued"`
+	Expiry       time.Time       `json:"expiry"`
+	TTL          int             `json:"ttl"`
+}
+
+// HasEntitlement reports whether the dataset's license has the entitlement.
+func (lic *LicenseFileDataset) HasEntitlement(code EntitlementCode) bool {
+	return lic.Entitlements.Has(code)
+}
+
+// RequireEntitlements checks that the dataset's license has every entitlement.
+// It returns an EntitlementsMissingError listing any missing codes.
+func (lic *LicenseFileDataset) RequireEntitlements(codes ...EntitlementCode) error {
+	return lic.Entitlements.Require(codes...)
 }
 
 // SetData implements the jsonapi.UnmarshalData interface.
@@ -150,6 +247,35 @@ func (lic *LicenseFileDataset) SetIncluded(relationships []*jsonapi.ResourceObje
 			}
 
 			lic.Entitlements = append(lic.Entitlements, *entitlement)
+		case "policies":
+			lic.Policy = &Policy{}
+			if err := unmarshal(relationship, lic.Policy); err != nil {
+				return err
+			}
+		case "users":
+			user := &User{}
+			if err := unmarshal(relationship, user); err != nil {
+				return err
+			}
+
+			// Prefer the license's owner when other users are included
+			if lic.User == nil || user.ID == lic.License.UserID {
+				lic.User = user
+			}
+		case "products":
+			lic.Product = &ProductDetails{}
+			if err := unmarshal(relationship, lic.Product); err != nil {
+				return err
+			}
+		case "groups":
+			group := &Group{}
+			if err := unmarshal(relationship, group); err != nil {
+				return err
+			}
+
+			if lic.Group == nil || group.ID == lic.License.GroupID {
+				lic.Group = group
+			}
 		}
 	}
 
@@ -0,0 +1,249 @@
+package keygen
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout is the default time allowed for a Lifecycle to clean
+// up its tracked resources during shutdown.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// ShutdownResult is the result of cleaning up a single tracked resource. Only
+// one of Machine or Process is set.
+type ShutdownResult struct {
+	Machine *Machine
+	Process *Process
+	Err     error
+}
+
+// Lifecycle tracks machines and processes created by the current program, so
+// that they can be cleaned up on shutdown instead of occupying a slot until
+// their heartbeat dies. Heartbeats started through the lifecycle are stopped
+// first, and then processes are killed before machines are deactivated.
+// A Lifecycle is safe for concurrent use by multiple goroutines.
+//
+// Example:
+//
+//	lifecycle := &keygen.Lifecycle{}
+//
+//	machine, err := lifecycle.Activate(ctx, license, fingerprint)
+//	if err != nil {
+//		panic(err)
+//	}
+//
+//	// Block until SIGINT or SIGTERM, then deactivate the machine
+//	for _, res := range lifecycle.ShutdownOnSignal(ctx) {
+//		if res.Err != nil {
+//			fmt.Printf("cleanup failed: err=%v\n", res.Err)
+//		}
+//	}
+type Lifecycle struct {
+	// Timeout bounds the time spent cleaning up resources during shutdown.
+	// Defaults to DefaultShutdownTimeout.
+	Timeout time.Duration
+
+	mu         sync.Mutex
+	machines   []*Machine
+	processes  []*Process
+	heartbeats []lifecycleHeartbeat
+}
+
+type lifecycleHeartbeat struct {
+	heartbeat *Heartbeat
+	cancel    context.CancelFunc
+}
+
+// Activate performs a machine activation for the license, and tracks the new
+// machine so that it's deactivated on shutdown. See License.Activate.
+func (lc *Lifecycle) Activate(ctx context.Context, license *License, fingerprint string, components ...Component) (*Machine, error) {
+	machine, err := license.Activate(ctx, fingerprint, components...)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.TrackMachine(machine)
+
+	return machine, nil
+}
+
+// StartHeartbeat starts a heartbeat for the machine, which is stopped on
+// shutdown before the machine is deactivated. See Machine.StartHeartbeat.
+func (lc *Lifecycle) StartHeartbeat(ctx context.Context, machine *Machine) (*Heartbeat, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	heartbeat, err := machine.StartHeartbeat(ctx)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	lc.trackHeartbeat(heartbeat, cancel)
+
+	return heartbeat, nil
+}
+
+// Spawn creates a new process for the machine, and tracks the new process so
+// that it's killed on shutdown. The process's heartbeat is stopped on shutdown
+// before the process is killed. See Machine.Spawn.
+func (lc *Lifecycle) Spawn(ctx context.Context, machine *Machine, pid string) (*Process, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	process, err := machine.Spawn(ctx, pid)
+	if process != nil {
+		lc.TrackProcess(process)
+	}
+
+	if process == nil || process.Heartbeat() == nil {
+		cancel()
+
+		return process, err
+	}
+
+	lc.trackHeartbeat(process.Heartbeat(), cancel)
+
+	return process, err
+}
+
+// TrackMachine tracks an existing machine, so that it's deactivated on shutdown.
+func (lc *Lifecycle) TrackMachine(machine *Machine) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.machines = append(lc.machines, machine)
+}
+
+// TrackProcess tracks an existing process, so that it's killed on shutdown.
+func (lc *Lifecycle) TrackProcess(process *Process) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.processes = append(lc.processes, process)
+}
+
+func (lc *Lifecycle) trackHeartbeat(heartbeat *Heartbeat, cancel context.CancelFunc) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.heartbeats = append(lc.heartbeats, lifecycleHeartbeat{heartbeat, cancel})
+}
+
+// ShutdownOnSignal blocks until one of the provided signals is received, or
+// until the context is done, and then shuts down. Defaults to SIGINT and
+// SIGTERM when no signals are provided. Since the context may already be
+// done, cleanup uses a new context bounded by the Timeout.
+func (lc *Lifecycle) ShutdownOnSignal(ctx context.Context, signals ...os.Signal) []ShutdownResult {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, signals...)
+	defer signal.Stop(sigs)
+
+	select {
+	case sig := <-sigs:
+		Logger.Infof("Caught signal, shutting down: signal=%v", sig)
+	case <-ctx.Done():
+		Logger.Infof("Context is done, shutting down: err=%v", ctx.Err())
+	}
+
+	return lc.Shutdown(context.Background())
+}
+
+// Shutdown stops all heartbeats started through the lifecycle, kills all tracked
+// processes and then deactivates all tracked machines, within the Timeout. It
+// returns a result for each resource. Resources are untracked once cleaned up,
+// and resources which no longer exist are considered cleaned up.
+func (lc *Lifecycle) Shutdown(ctx context.Context) []ShutdownResult {
+	timeout := lc.Timeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lc.mu.Lock()
+	heartbeats := lc.heartbeats
+	processes := lc.processes
+	machines := lc.machines
+	lc.heartbeats = nil
+	lc.processes = nil
+	lc.machines = nil
+	lc.mu.Unlock()
+
+	// Stop heartbeats first, so that they don't keep pinging deleted resources
+	for _, hb := range heartbeats {
+		hb.cancel()
+	}
+
+	for _, hb := range heartbeats {
+		select {
+		case <-hb.heartbeat.Done():
+		case <-ctx.Done():
+		}
+	}
+
+	results := make([]ShutdownResult, len(processes)+len(machines))
+
+	// Kill processes first, since they belong to machines
+	var wg sync.WaitGroup
+	for i, process := range processes {
+		wg.Add(1)
+
+		go func(i int, process *Process) {
+			defer wg.Done()
+
+			results[i] = ShutdownResult{Process: process, Err: ignoreNotFound(process.Kill(ctx))}
+		}(i, process)
+	}
+
+	wg.Wait()
+
+	for i, machine := range machines {
+		wg.Add(1)
+
+		go func(i int, machine *Machine) {
+			defer wg.Done()
+
+			results[len(processes)+i] = ShutdownResult{Machine: machine, Err: ignoreNotFound(machine.Deactivate(ctx))}
+		}(i, machine)
+	}
+
+	wg.Wait()
+
+	// Keep tracking resources that failed to clean up, so that shutdown
+	// can be retried.
+	for _, res := range results {
+		if res.Err == nil {
+			continue
+		}
+
+		switch {
+		case res.Process != nil:
+			Logger.Errorf("Error killing process: id=%s err=%v", res.Process.ID, res.Err)
+
+			lc.TrackProcess(res.Process)
+		case res.Machine != nil:
+			Logger.Errorf("Error deactivating machine: id=%s err=%v", res.Machine.ID, res.Err)
+
+			lc.TrackMachine(res.Machine)
+		}
+	}
+
+	return results
+}
+
+func ignoreNotFound(err error) error {
+	if _, ok := err.(*NotFoundError); ok {
+		return nil
+	}
+
+	return err
+}
@@ -77,6 +77,7 @@ type Machine struct {
 	LicenseID         string                 `json:"-"`
 
 	components []Component `json:"-"`
+	config     *Config     `json:"-"`
 }
 
 // GetID implements the jsonapi.MarshalResourceIdentifier interface.
@@ -127,10 +128,43 @@ func (m *Machines) SetData(to func(target interface{}) error) error {
 	return to(m)
 }
 
+// MachineIterator iterates over a paginated list of machines, requesting
+// additional pages as needed.
+type MachineIterator struct {
+	iterator
+	machines Machines
+	config   *Config
+}
+
+// Next advances the iterator to the next machine. It returns false when there
+// are no more machines or when an error occurs. Check Err after iterating.
+func (it *MachineIterator) Next() bool {
+	return it.next(func() (bool, int, error) {
+		it.machines = Machines{}
+
+		ok, err := it.pager.fetch(it.ctx, &it.machines)
+		for i := range it.machines {
+			it.machines[i].config = it.config
+		}
+
+		return ok, len(it.machines), err
+	})
+}
+
+// Machine returns the current machine.
+func (it *MachineIterator) Machine() *Machine {
+	return &it.machines[it.index]
+}
+
+// Err returns the error, if any, that occurred during iteration.
+func (it *MachineIterator) Err() error {
+	return it.err
+}
+
 // Deactivate performs a machine deactivation for the current Machine. An error
 // will be returned if the machine deactivation fails.
 func (m *Machine) Deactivate(ctx context.Context) error {
-	client := NewClient()
+	client := m.config.NewClient()
 
 	if _, err := client.Delete(ctx, "machines/"+m.ID, nil, nil); err != nil {
 		return err
@@ -139,33 +173,51 @@ func (m *Machine) Deactivate(ctx context.Context) error {
 	return nil
 }
 
-// Monitor performs, on a loop, a machine hearbeat ping for the current Machine. An
-// error channel will be returned, where any ping errors will be emitted. Pings are
-// sent according to the machine's required heartbeat window, minus 30 seconds to
-// account for any network lag. Panics if a heartbeat ping fails after first ping.
+// Monitor performs, on a loop, a machine hearbeat ping for the current Machine,
+// until the context is cancelled or the heartbeat is dead. Pings are sent
+// according to the machine's required heartbeat window, minus 30 seconds to
+// account for any network lag. Any ping errors after the first ping are
+// logged. Use StartHeartbeat to handle ping errors.
 func (m *Machine) Monitor(ctx context.Context) error {
-	if err := m.ping(ctx); err != nil {
+	heartbeat, err := m.StartHeartbeat(ctx)
+	if err != nil {
 		return err
 	}
 
 	go func() {
-		t := (time.Duration(m.HeartbeatDuration) * time.Second) - (30 * time.Second)
-
-		for range time.Tick(t) {
-			if err := m.ping(ctx); err != nil {
-				panic(err)
-			}
+		for err := range heartbeat.Errors() {
+			Logger.Errorf("Machine heartbeat error: id=%s err=%v", m.ID, err)
 		}
 	}()
 
 	return nil
 }
 
+// StartHeartbeat sends a heartbeat ping for the current Machine, and then starts
+// a Heartbeat which pings on a loop according to the machine's heartbeat window,
+// until the context is cancelled or the heartbeat is dead. An error will be
+// returned if the first ping fails.
+func (m *Machine) StartHeartbeat(ctx context.Context) (*Heartbeat, error) {
+	if err := m.ping(ctx); err != nil {
+		return nil, err
+	}
+
+	// Subsequent pings use a copy, so that the loop doesn't race with the
+	// caller's use of the machine.
+	machine := &Machine{ID: m.ID, config: m.config}
+	window := time.Duration(m.HeartbeatDuration) * time.Second
+	heartbeat := newHeartbeat(machine.ping, window, m.config.clock())
+
+	heartbeat.start(ctx)
+
+	return heartbeat, nil
+}
+
 // Checkout generates an encrypted machine file. Returns a MachineFile.
 func (m *Machine) Checkout(ctx context.Context, options ...CheckoutOption) (*MachineFile, error) {
-	client := NewClient()
+	client := m.config.NewClient()
 	license := &License{}
-	lic := &MachineFile{}
+	lic := &MachineFile{config: m.config}
 
 	opts := CheckoutOptions{Encrypt: true, Include: "license,license.entitlements"}
 	for _, opt := range options {
@@ -185,9 +237,10 @@ func (m *Machine) Checkout(ctx context.Context, options ...CheckoutOption) (*Mac
 	return lic, nil
 }
 
-// Components lists up to 100 components for the machine.
+// Components lists up to 100 components for the machine. See AllComponents to
+// list every component.
 func (m *Machine) Components(ctx context.Context) (Components, error) {
-	client := NewClient()
+	client := m.config.NewClient()
 	components := Components{}
 
 	if _, err := client.Get(ctx, "machines/"+m.ID+"/components", querystring{Limit: 100}, &components); err != nil {
@@ -197,19 +250,44 @@ func (m *Machine) Components(ctx context.Context) (Components, error) {
 	return components, nil
 }
 
+// IterateComponents returns an iterator over all components for the machine,
+// which requests additional pages as needed.
+func (m *Machine) IterateComponents(ctx context.Context) *ComponentIterator {
+	pager := newPager(m.config.NewClient(), "machines/"+m.ID+"/components")
+
+	return &ComponentIterator{iterator: newIterator(ctx, pager)}
+}
+
+// AllComponents lists all components for the machine, requesting every page.
+func (m *Machine) AllComponents(ctx context.Context) (Components, error) {
+	components := Components{}
+
+	it := m.IterateComponents(ctx)
+	for it.Next() {
+		components = append(components, *it.Component())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return components, nil
+}
+
 // Spawn creates a new process for a machine, identified by the provided pid. If
 // successful, the new Process will be returned. When unsuccessful, as error
 // will be returned, e.g. ErrProcessLimitExceeded. Automatically starts a loop
-// that sends heartbeat pings according to the process's Interval. Panics if a
-// heartbeat ping fails after first ping.
+// that sends heartbeat pings according to the process's Interval, until the
+// context is cancelled or the heartbeat is dead. See Process.Heartbeat to
+// handle ping errors.
 func (m *Machine) Spawn(ctx context.Context, pid string) (*Process, error) {
-	client := NewClient()
+	client := m.config.NewClient()
 	params := &Process{
 		Pid:       pid,
 		MachineID: m.ID,
 	}
 
-	process := &Process{}
+	process := &Process{config: m.config}
 	if _, err := client.Post(ctx, "processes", params, process); err != nil {
 		return nil, err
 	}
@@ -221,22 +299,55 @@ func (m *Machine) Spawn(ctx context.Context, pid string) (*Process, error) {
 	return process, nil
 }
 
-// Processes lists up to 100 processes for the machine.
+// Processes lists up to 100 processes for the machine. See AllProcesses to list
+// every process.
 func (m *Machine) Processes(ctx context.Context) (Processes, error) {
-	client := NewClient()
+	client := m.config.NewClient()
 	processes := Processes{}
 
 	if _, err := client.Get(ctx, "machines/"+m.ID+"/processes", querystring{Limit: 100}, &processes); err != nil {
 		return nil, err
 	}
 
+	for i := range processes {
+		processes[i].config = m.config
+	}
+
+	return processes, nil
+}
+
+// IterateProcesses returns an iterator over all processes for the machine,
+// which requests additional pages as needed.
+func (m *Machine) IterateProcesses(ctx context.Context) *ProcessIterator {
+	pager := newPager(m.config.NewClient(), "machines/"+m.ID+"/processes")
+
+	return &ProcessIterator{iterator: newIterator(ctx, pager), config: m.config}
+}
+
+// AllProcesses lists all processes for the machine, requesting every page.
+func (m *Machine) AllProcesses(ctx context.Context) (Processes, error) {
+	processes := Processes{}
+
+	it := m.IterateProcesses(ctx)
+	for it.Next() {
+		processes = append(processes, *it.Process())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
 	return processes, nil
 }
 
 func (m *Machine) ping(ctx context.Context) error {
-	client := NewClient()
+	client := m.config.NewClient()
 
 	if _, err := client.Post(ctx, "machines/"+m.ID+"/actions/ping", nil, m); err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return ErrMachineNotFound
+		}
+
 		return err
 	}
 
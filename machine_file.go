@@ -3,6 +3,8 @@ package keygen
 import (
 	"encoding/base64"
 	"encoding/json"
+	"io"
+	"os"
 	"strings"
 	"time"
 
@@ -19,6 +21,40 @@ type MachineFile struct {
 	TTL         int       `json:"ttl"`
 	MachineID   string    `json:"-"`
 	LicenseID   string    `json:"-"`
+
+	config *Config `json:"-"`
+}
+
+// ParseMachineFile parses a machine file from its certificate, e.g. the contents
+// of a .lic file, or a raw certificate without armor. It returns an error if
+// the certificate is malformed, e.g. an ArmorError for a license file.
+func ParseMachineFile(cert string) (*MachineFile, error) {
+	lic := &MachineFile{Certificate: armor(cert)}
+	if _, err := lic.certificate(); err != nil {
+		return nil, err
+	}
+
+	return lic, nil
+}
+
+// ReadMachineFile reads and parses a machine file. See ParseMachineFile.
+func ReadMachineFile(r io.Reader) (*MachineFile, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseMachineFile(string(b))
+}
+
+// LoadMachineFile reads and parses a machine file from a path. See ParseMachineFile.
+func LoadMachineFile(path string) (*MachineFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseMachineFile(string(b))
 }
 
 // SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
@@ -54,7 +90,8 @@ func (lic *MachineFile) SetRelationships(relationships map[string]interface{}) e
 // Decrypt verifies the machine file's signature. It returns any errors
 // that occurred during verification, e.g. ErrMachineFileInvalid.
 func (lic *MachineFile) Verify() error {
-	verifier := &verifier{PublicKey: PublicKey}
+	cfg := lic.config.resolve()
+	verifier := &verifier{PublicKey: cfg.PublicKey, RSAPublicKey: cfg.RSAPublicKey}
 
 	if err := verifier.VerifyMachineFile(lic); err != nil {
 		return &MachineFileError{err}
@@ -72,10 +109,12 @@ func (lic *MachineFile) Decrypt(key string) (*MachineFileDataset, error) {
 	}
 
 	switch {
-	case cert.Alg == "aes-256-gcm+rsa-pss-sha256" || cert.Alg == "aes-256-gcm+rsa-sha256":
-		return nil, ErrMachineFileNotSupported
-	case cert.Alg != "aes-256-gcm+ed25519":
+	case cert.Alg == "aes-256-gcm+ed25519" || cert.Alg == "aes-256-gcm+rsa-pss-sha256" || cert.Alg == "aes-256-gcm+rsa-sha256":
+		// noop
+	case strings.HasPrefix(cert.Alg, "base64+"):
 		return nil, ErrMachineFileNotEncrypted
+	default:
+		return nil, ErrMachineFileNotSupported
 	}
 
 	// Decrypt
@@ -85,6 +124,46 @@ func (lic *MachineFile) Decrypt(key string) (*MachineFileDataset, error) {
 		return nil, &MachineFileError{err}
 	}
 
+	return lic.dataset(data)
+}
+
+// Decode verifies and decodes the machine file's unencrypted dataset, i.e. a machine file
+// checked out using CheckoutEncrypt(false). It returns the decoded dataset and any errors
+// that occurred during verification or decoding, e.g. ErrMachineFileNotGenuine or
+// ErrMachineFileEncrypted.
+func (lic *MachineFile) Decode() (*MachineFileDataset, error) {
+	cert, err := lic.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(cert.Alg, "base64+") {
+		return nil, ErrMachineFileEncrypted
+	}
+
+	if err := lic.Verify(); err != nil {
+		return nil, err
+	}
+
+	// Decode
+	data, err := base64.StdEncoding.DecodeString(cert.Enc)
+	if err != nil {
+		return nil, &MachineFileError{err}
+	}
+
+	return lic.dataset(data)
+}
+
+// open decrypts or decodes the machine file's dataset, depending on whether it's encrypted.
+func (lic *MachineFile) open(key string) (*MachineFileDataset, error) {
+	if cert, err := lic.certificate(); err == nil && strings.HasPrefix(cert.Alg, "base64+") {
+		return lic.Decode()
+	}
+
+	return lic.Decrypt(key)
+}
+
+func (lic *MachineFile) dataset(data []byte) (*MachineFileDataset, error) {
 	// Unmarshal
 	dataset := &MachineFileDataset{}
 
@@ -92,11 +171,15 @@ func (lic *MachineFile) Decrypt(key string) (*MachineFileDataset, error) {
 		return nil, &MachineFileError{err}
 	}
 
-	if MaxClockDrift >= 0 && time.Until(dataset.Issued) > MaxClockDrift {
+	dataset.Machine.config = lic.config
+	dataset.License.config = lic.config
+
+	now := lic.config.clock().Now()
+	if MaxClockDrift >= 0 && dataset.Issued.Sub(now) > MaxClockDrift {
 		return dataset, ErrSystemClockUnsynced
 	}
 
-	if dataset.TTL != 0 && time.Now().After(dataset.Expiry) {
+	if dataset.TTL != 0 && now.After(dataset.Expiry) {
 		return dataset, ErrMachineFileExpired
 	}
 
@@ -104,11 +187,11 @@ func (lic *MachineFile) Decrypt(key string) (*MachineFileDataset, error) {
 }
 
 func (lic *MachineFile) certificate() (*certificate, error) {
-	payload := lic.Certificate
-
 	// Remove header and footer
-	payload = strings.TrimPrefix(payload, "-----BEGIN MACHINE FILE-----\n")
-	payload = strings.TrimSuffix(payload, "-----END MACHINE FILE-----\n")
+	payload, err := unarmor(lic.Certificate, machineFileLabel)
+	if err != nil {
+		return nil, &MachineFileError{err}
+	}
 
 	// Decode
 	dec, err := base64.StdEncoding.DecodeString(payload)
@@ -127,13 +210,28 @@ func (lic *MachineFile) certificate() (*certificate, error) {
 
 // MachineFileDataset represents a decrypted machine file object.
 type MachineFileDataset struct {
-	Machine      Machine      `json:"-"`
-	License      License      `json:"-"`
-	Entitlements Entitlements `json:"-"`
-	Components   Components   `json:"-"`
-	Issued       time.Time    `json:"issued"`
-	Expiry       time.Time    `json:"expiry"`
-	TTL          int          `json:"ttl"`
+	Machine      Machine         `json:"-"`
+	License      License         `json:"-"`
+	Entitlements Entitlements    `json:"-"`
+	Components   Components      `json:"-"`
+	Policy       *Policy         `json:"-"`
+	User         *User           `json:"-"`
+	Product      *ProductDetails `json:"-"`
+	Group        *Group          `json:"-"`
+	Issued       time.Time       `json:"issued"`
+	Expiry       time.Time       `json:"expiry"`
+	TTL          int             `json:"ttl"`
+}
+
+// HasEntitlement reports whether the dataset's license has the entitlement.
+func (lic *MachineFileDataset) HasEntitlement(code EntitlementCode) bool {
+	return lic.Entitlements.Has(code)
+}
+
+// RequireEntitlements checks that the dataset's license has every entitlement.
+// It returns an EntitlementsMissingError listing any missing codes.
+func (lic *MachineFileDataset) RequireEntitlements(codes ...EntitlementCode) error {
+	return lic.Entitlements.Require(codes...)
 }
 
 // SetData implements the jsonapi.UnmarshalData interface.
@@ -148,6 +246,11 @@ func (lic *MachineFileDataset) SetMeta(to func(target interface{}) error) error
 
 // SetIncluded implements jsonapi.UnmarshalIncluded interface.
 func (lic *MachineFileDataset) SetIncluded(relationships []*jsonapi.ResourceObject, unmarshal func(res *jsonapi.ResourceObject, target interface{}) error) error {
+	var (
+		users  []User
+		groups []Group
+	)
+
 	for _, relationship := range relationships {
 		switch relationship.Type {
 		case "components":
@@ -171,8 +274,48 @@ func (lic *MachineFileDataset) SetIncluded(relationships []*jsonapi.ResourceObje
 			}
 
 			lic.License = *license
+		case "policies":
+			lic.Policy = &Policy{}
+			if err := unmarshal(relationship, lic.Policy); err != nil {
+				return err
+			}
+		case "users":
+			user := &User{}
+			if err := unmarshal(relationship, user); err != nil {
+				return err
+			}
+
+			users = append(users, *user)
+		case "products":
+			lic.Product = &ProductDetails{}
+			if err := unmarshal(relationship, lic.Product); err != nil {
+				return err
+			}
+		case "groups":
+			group := &Group{}
+			if err := unmarshal(relationship, group); err != nil {
+				return err
+			}
+
+			groups = append(groups, *group)
+		}
+	}
+
+	// The license may be included after its user and group, so match them up
+	// once everything has been unmarshaled, preferring the license's owner.
+	for i, user := range users {
+		if i == 0 || user.ID == lic.License.UserID {
+			lic.User = &users[i]
 		}
 	}
 
+	for i, group := range groups {
+		if i == 0 || group.ID == lic.License.GroupID {
+			lic.Group = &groups[i]
+		}
+	}
+
+	lic.Machine.components = lic.Components
+
 	return nil
 }
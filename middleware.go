@@ -0,0 +1,48 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// EntitlementCheck checks for entitlements, e.g. License.RequireEntitlements.
+type EntitlementCheck func(ctx context.Context, codes ...EntitlementCode) error
+
+// EntitlementMiddleware returns HTTP middleware that only serves requests when
+// check passes for the given entitlements. Requests are rejected with 403
+// Forbidden when an entitlement is missing, or 503 Service Unavailable when
+// the entitlements can't be checked, e.g. due to a network error.
+//
+// Example:
+//
+//	func main() {
+//		license, err := keygen.Validate(context.Background())
+//		if err != nil {
+//			panic(err)
+//		}
+//
+//		gated := keygen.EntitlementMiddleware(license.RequireEntitlements, "EXPORTS")
+//
+//		http.Handle("/exports", gated(http.HandlerFunc(exports)))
+//		http.ListenAndServe(":8080", nil)
+//	}
+func EntitlementMiddleware(check EntitlementCheck, codes ...EntitlementCode) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := check(r.Context(), codes...)
+
+			var e *EntitlementsMissingError
+			switch {
+			case errors.As(err, &e):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case err != nil:
+				Logger.Errorf("Error checking entitlements: codes=%v err=%v", codes, err)
+
+				http.Error(w, "entitlements are unavailable", http.StatusServiceUnavailable)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
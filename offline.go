@@ -0,0 +1,229 @@
+package keygen
+
+import (
+	"errors"
+	"time"
+)
+
+// OfflineOptions contains the license key and files used for an offline
+// license validation.
+type OfflineOptions struct {
+	// LicenseKey is the license key used to decrypt the license file, and the
+	// machine file along with the machine's fingerprint. Defaults to the
+	// current LicenseKey.
+	LicenseKey string
+
+	// LicenseFile is the license file being validated. Optional when a
+	// machine file is provided.
+	LicenseFile *LicenseFile
+
+	// MachineFile is the machine file being validated. Required for
+	// fingerprint-scoped validation.
+	MachineFile *MachineFile
+
+	// Entitlements are the entitlement codes the license is required to have.
+	Entitlements []EntitlementCode
+
+	// MaxAge is the maximum time since the files were issued. Zero means the
+	// files may be used until their TTL expires.
+	MaxAge time.Duration
+
+	// LastSeen, when set, persists a high-water mark of the latest time seen,
+	// so that ErrSystemClockUnsynced is returned when the system clock has been
+	// rolled back since a previous validation, beyond MaxClockDrift.
+	LastSeen LastSeenStore
+}
+
+// ValidateOffline performs a license validation without contacting the API, using
+// a license file and/or a machine file, scoped to any provided fingerprints. Like
+// Validate, the first fingerprint should be a machine fingerprint, and the rest
+// are optional component fingerprints.
+//
+// The files are cryptographically verified and decrypted using your PublicKey and
+// the license key, and the decrypted license is checked for suspension, expiry,
+// and that the fingerprints match the machine file's machine and components. It
+// returns the License, with its LastValidation result, and an error if the files
+// are not genuine, e.g. ErrLicenseFileNotGenuine or ErrMachineFileExpired, or if
+// the license is invalid, e.g. ErrLicenseNotActivated or ErrLicenseExpired. Use
+// a LastSeen store to detect the system clock being rolled back between runs.
+func ValidateOffline(options OfflineOptions, fingerprints ...string) (*License, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.ValidateOffline(options, fingerprints...)
+}
+
+// ValidateOffline performs an offline license validation using the config's
+// PublicKey and LicenseKey. See the package-level ValidateOffline.
+func (c *Config) ValidateOffline(options OfflineOptions, fingerprints ...string) (*License, error) {
+	cfg := c.resolve()
+
+	key := options.LicenseKey
+	if key == "" {
+		key = cfg.LicenseKey
+	}
+
+	if key == "" {
+		return nil, ErrLicenseKeyMissing
+	}
+
+	if options.LicenseFile == nil && options.MachineFile == nil {
+		return nil, ErrValidationFileMissing
+	}
+
+	now := c.clock().Now()
+	if options.LastSeen != nil {
+		if err := checkLastSeen(options.LastSeen, key, now); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		license      *License
+		machine      *Machine
+		components   Components
+		entitlements Entitlements
+		mismatch     bool
+	)
+
+	if options.LicenseFile != nil {
+		lic := *options.LicenseFile
+		lic.config = c
+
+		if err := lic.Verify(); err != nil {
+			return nil, err
+		}
+
+		dataset, err := lic.open(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if options.MaxAge > 0 && now.Sub(dataset.Issued) > options.MaxAge {
+			return nil, ErrLicenseFileExpired
+		}
+
+		license = &dataset.License
+		entitlements = dataset.Entitlements
+	}
+
+	if options.MachineFile != nil {
+		if len(fingerprints) == 0 {
+			return nil, ErrValidationFingerprintMissing
+		}
+
+		mf := *options.MachineFile
+		mf.config = c
+
+		if err := mf.Verify(); err != nil {
+			return nil, err
+		}
+
+		// Machine files are encrypted using the license key and the machine's
+		// fingerprint, so a genuine machine file that fails authentication was
+		// issued for another machine.
+		dataset, err := mf.open(key + fingerprints[0])
+		switch {
+		case errors.Is(err, errDecryptionFailed):
+			mismatch = true
+		case err != nil:
+			return nil, err
+		case options.MaxAge > 0 && now.Sub(dataset.Issued) > options.MaxAge:
+			return nil, ErrMachineFileExpired
+		default:
+			if license != nil && license.ID != dataset.License.ID {
+				return nil, ErrLicenseInvalid
+			}
+
+			if license == nil {
+				license = &dataset.License
+			}
+
+			if len(entitlements) == 0 {
+				entitlements = dataset.Entitlements
+			}
+
+			machine = &dataset.Machine
+			components = dataset.Components
+		}
+	}
+
+	if license == nil {
+		license = &License{Key: key}
+	}
+
+	// Unencrypted files can be read without the license key, so check that
+	// they were issued for it
+	if license.Key != key {
+		return nil, ErrLicenseInvalid
+	}
+
+	if options.LastSeen != nil {
+		if err := advanceLastSeen(options.LastSeen, key, now, lastSeenUntrusted); err != nil {
+			Logger.Warnf("Error storing last seen time: err=%v", err)
+		}
+	}
+
+	license.config = c
+
+	// Verify signed keys, in case the license file was issued for another key
+	if license.Scheme != "" {
+		if _, err := license.Verify(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := ValidationResult{Scope: &ValidationScope{scope{Product: cfg.Product}}, Source: ValidationSourceCache}
+	if cfg.Environment != "" {
+		result.Scope.Environment = &cfg.Environment
+	}
+
+	if n := len(fingerprints); n > 0 {
+		result.Scope.Fingerprint = fingerprints[0]
+
+		if n > 1 {
+			result.Scope.Components = fingerprints[1:]
+		}
+	}
+
+	switch {
+	case license.Status == LicenseStatusCodeBanned:
+		result.Code, result.Detail = ValidationCodeBanned, "is banned"
+	case license.Status == LicenseStatusCodeSuspended:
+		result.Code, result.Detail = ValidationCodeSuspended, "is suspended"
+	case license.Expiry != nil && now.After(*license.Expiry):
+		result.Code, result.Detail = ValidationCodeExpired, "is expired"
+	case mismatch:
+		result.Code, result.Detail = ValidationCodeFingerprintScopeMismatch, "fingerprint is not activated (does not match the machine file)"
+	case len(fingerprints) > 0 && machine == nil:
+		result.Code, result.Detail = ValidationCodeNoMachine, "fingerprint is not activated (has no machine file)"
+	case machine != nil && machine.Fingerprint != fingerprints[0]:
+		result.Code, result.Detail = ValidationCodeFingerprintScopeMismatch, "fingerprint is not activated (does not match the machine file)"
+	case !components.contains(result.Scope.Components...):
+		result.Code, result.Detail = ValidationCodeComponentsScopeMismatch, "one or more component is not activated (does not match the machine file)"
+	case entitlements.Require(options.Entitlements...) != nil:
+		result.Code, result.Detail = ValidationCodeEntitlementsMissing, "is missing one or more required entitlements"
+	default:
+		result.Code, result.Detail = ValidationCodeValid, "is valid"
+	}
+
+	result.Valid = result.Code == ValidationCodeValid
+	license.LastValidation = &result
+
+	return license, validationError(result.Code)
+}
+
+// contains checks that every fingerprint belongs to one of the components.
+func (c Components) contains(fingerprints ...string) bool {
+	activated := map[string]bool{}
+	for _, component := range c {
+		activated[component.Fingerprint] = true
+	}
+
+	for _, fingerprint := range fingerprints {
+		if !activated[fingerprint] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -13,6 +13,16 @@ type CheckoutOptions struct {
 
 type CheckoutOption func(*CheckoutOptions) error
 
+// CheckoutEncrypt sets whether the checked out file is encrypted. Encrypted files
+// are read using Decrypt, and unencrypted files using Decode. Defaults to true.
+func CheckoutEncrypt(encrypt bool) CheckoutOption {
+	return func(options *CheckoutOptions) error {
+		options.Encrypt = encrypt
+
+		return nil
+	}
+}
+
 func CheckoutInclude(includes ...string) CheckoutOption {
 	return func(options *CheckoutOptions) error {
 		options.Include = strings.Join(includes, ",")
@@ -0,0 +1,149 @@
+package keygen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// PageSize is the number of resources requested per page when iterating
+// over paginated lists, e.g. a license's machines.
+var PageSize = 100
+
+type links struct {
+	Next *string `json:"next"`
+}
+
+// pager requests consecutive pages of a list endpoint, following the
+// links.next URL of the JSON:API document.
+type pager struct {
+	client *Client
+	path   string
+	size   int
+	next   *url.URL
+	seen   map[string]bool
+	done   bool
+}
+
+func newPager(client *Client, path string) *pager {
+	return &pager{client: client, path: path, size: PageSize, seen: map[string]bool{}}
+}
+
+// fetch requests the next page into the model. It returns false when
+// there are no more pages.
+func (p *pager) fetch(ctx context.Context, model interface{}) (bool, error) {
+	if p.done {
+		return false, nil
+	}
+
+	var res *Response
+	var err error
+
+	if p.next == nil {
+		res, err = p.client.Get(ctx, p.path, querystring{PageNumber: 1, PageSize: p.size}, model)
+	} else {
+		res, err = p.get(ctx, p.next, model)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	var doc struct {
+		Links links `json:"links"`
+	}
+
+	if err := json.Unmarshal(res.Body, &doc); err != nil {
+		return false, err
+	}
+
+	p.seen[res.Request.URL.String()] = true
+	p.next = p.nextURL(res.Request.URL, doc.Links)
+	p.done = p.next == nil
+
+	return true, nil
+}
+
+// get requests a page's URL as given by the server, using the client's
+// usual headers and authentication.
+func (p *pager) get(ctx context.Context, u *url.URL, model interface{}) (*Response, error) {
+	req, err := p.client.new(ctx, http.MethodGet, p.path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL = u
+
+	return p.client.send(req, model)
+}
+
+// nextURL resolves the next page's link against the current page's URL. It
+// returns nil when there's no next page, and stops paginating when the link
+// is for another host, so that credentials aren't sent elsewhere, or when
+// it's been seen before, so a misbehaving server can't make us loop forever.
+func (p *pager) nextURL(base *url.URL, l links) *url.URL {
+	if l.Next == nil || *l.Next == "" {
+		return nil
+	}
+
+	ref, err := url.Parse(*l.Next)
+	if err != nil {
+		Logger.Warnf("Error parsing next page link: next=%s err=%v", *l.Next, err)
+
+		return nil
+	}
+
+	u := base.ResolveReference(ref)
+	switch {
+	case u.Scheme != base.Scheme || u.Host != base.Host:
+		Logger.Warnf("Ignoring next page link for another host: next=%s", u)
+
+		return nil
+	case p.seen[u.String()]:
+		return nil
+	}
+
+	return u
+}
+
+// iterator implements the common cursor logic for paginated iterators. The
+// typed iterators provide a fetch func which loads the next page and returns
+// its length.
+type iterator struct {
+	ctx   context.Context
+	pager *pager
+	index int
+	size  int
+	err   error
+}
+
+func newIterator(ctx context.Context, pager *pager) iterator {
+	return iterator{ctx: ctx, pager: pager, index: -1}
+}
+
+func (it *iterator) next(fetch func() (bool, int, error)) bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+
+	for it.index >= it.size {
+		ok, n, err := fetch()
+		if err != nil {
+			it.err = err
+
+			return false
+		}
+
+		if !ok {
+			return false
+		}
+
+		it.index = 0
+		it.size = n
+	}
+
+	return true
+}
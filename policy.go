@@ -0,0 +1,55 @@
+package keygen
+
+import "time"
+
+// Policy represents a Keygen policy object.
+type Policy struct {
+	ID                            string                 `json:"-"`
+	Type                          string                 `json:"-"`
+	Name                          string                 `json:"name"`
+	Duration                      *int                   `json:"duration"`
+	Strict                        bool                   `json:"strict"`
+	Floating                      bool                   `json:"floating"`
+	Scheme                        SchemeCode             `json:"scheme"`
+	RequireHeartbeat              bool                   `json:"requireHeartbeat"`
+	HeartbeatDuration             *int                   `json:"heartbeatDuration"`
+	HeartbeatCullStrategy         string                 `json:"heartbeatCullStrategy"`
+	HeartbeatResurrectionStrategy string                 `json:"heartbeatResurrectionStrategy"`
+	HeartbeatBasis                string                 `json:"heartbeatBasis"`
+	MaxMachines                   *int                   `json:"maxMachines"`
+	MaxProcesses                  *int                   `json:"maxProcesses"`
+	MaxCores                      *int                   `json:"maxCores"`
+	MaxUses                       *int                   `json:"maxUses"`
+	RequireCheckIn                bool                   `json:"requireCheckIn"`
+	CheckInInterval               *string                `json:"checkInInterval"`
+	CheckInIntervalCount          *int                   `json:"checkInIntervalCount"`
+	ExpirationStrategy            string                 `json:"expirationStrategy"`
+	ExpirationBasis               string                 `json:"expirationBasis"`
+	AuthenticationStrategy        string                 `json:"authenticationStrategy"`
+	MachineUniquenessStrategy     string                 `json:"machineUniquenessStrategy"`
+	MachineMatchingStrategy       string                 `json:"machineMatchingStrategy"`
+	ComponentUniquenessStrategy   string                 `json:"componentUniquenessStrategy"`
+	ComponentMatchingStrategy     string                 `json:"componentMatchingStrategy"`
+	OverageStrategy               string                 `json:"overageStrategy"`
+	Protected                     bool                   `json:"protected"`
+	Created                       time.Time              `json:"created"`
+	Updated                       time.Time              `json:"updated"`
+	Metadata                      map[string]interface{} `json:"metadata"`
+}
+
+// SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
+func (p *Policy) SetID(id string) error {
+	p.ID = id
+	return nil
+}
+
+// SetType implements the jsonapi.UnmarshalResourceIdentifier interface.
+func (p *Policy) SetType(t string) error {
+	p.Type = t
+	return nil
+}
+
+// SetData implements the jsonapi.UnmarshalData interface.
+func (p *Policy) SetData(to func(target interface{}) error) error {
+	return to(p)
+}
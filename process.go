@@ -59,6 +59,9 @@ type Process struct {
 	Updated   time.Time              `json:"updated"`
 	Metadata  map[string]interface{} `json:"metadata"`
 	MachineID string                 `json:"-"`
+
+	config    *Config    `json:"-"`
+	heartbeat *Heartbeat `json:"-"`
 }
 
 // GetID implements the jsonapi.MarshalResourceIdentifier interface.
@@ -105,10 +108,43 @@ func (p *Processes) SetData(to func(target interface{}) error) error {
 	return to(p)
 }
 
+// ProcessIterator iterates over a paginated list of processes, requesting
+// additional pages as needed.
+type ProcessIterator struct {
+	iterator
+	processes Processes
+	config    *Config
+}
+
+// Next advances the iterator to the next process. It returns false when there
+// are no more processes or when an error occurs. Check Err after iterating.
+func (it *ProcessIterator) Next() bool {
+	return it.next(func() (bool, int, error) {
+		it.processes = Processes{}
+
+		ok, err := it.pager.fetch(it.ctx, &it.processes)
+		for i := range it.processes {
+			it.processes[i].config = it.config
+		}
+
+		return ok, len(it.processes), err
+	})
+}
+
+// Process returns the current process.
+func (it *ProcessIterator) Process() *Process {
+	return &it.processes[it.index]
+}
+
+// Err returns the error, if any, that occurred during iteration.
+func (it *ProcessIterator) Err() error {
+	return it.err
+}
+
 // Kill deletes the current Process. An error will be returned if the process
 // deletion fails.
 func (p *Process) Kill(ctx context.Context) error {
-	client := NewClient()
+	client := p.config.NewClient()
 
 	if _, err := client.Delete(ctx, "processes/"+p.ID, nil, nil); err != nil {
 		return err
@@ -117,28 +153,39 @@ func (p *Process) Kill(ctx context.Context) error {
 	return nil
 }
 
+// Heartbeat returns the process's running Heartbeat, which can be used to
+// handle ping errors. Returns nil if the process was not spawned by
+// Machine.Spawn.
+func (p *Process) Heartbeat() *Heartbeat {
+	return p.heartbeat
+}
+
 func (p *Process) monitor(ctx context.Context) error {
 	if err := p.ping(ctx); err != nil {
 		return err
 	}
 
-	go func() {
-		t := (time.Duration(p.Interval) * time.Second) - (30 * time.Second)
+	// Subsequent pings use a copy, so that the loop doesn't race with the
+	// caller's use of the process.
+	process := &Process{ID: p.ID, config: p.config}
+	window := time.Duration(p.Interval) * time.Second
+	heartbeat := newHeartbeat(process.ping, window, p.config.clock())
 
-		for range time.Tick(t) {
-			if err := p.ping(ctx); err != nil {
-				panic(err)
-			}
-		}
-	}()
+	heartbeat.start(ctx)
+
+	p.heartbeat = heartbeat
 
 	return nil
 }
 
 func (p *Process) ping(ctx context.Context) error {
-	client := NewClient()
+	client := p.config.NewClient()
 
 	if _, err := client.Post(ctx, "processes/"+p.ID+"/actions/ping", nil, p); err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return ErrProcessNotFound
+		}
+
 		return err
 	}
 
@@ -0,0 +1,35 @@
+package keygen
+
+import "time"
+
+// ProductDetails represents a Keygen product object. It is named so as not to
+// clash with the Product setting.
+type ProductDetails struct {
+	ID                   string                 `json:"-"`
+	Type                 string                 `json:"-"`
+	Name                 string                 `json:"name"`
+	Code                 string                 `json:"code"`
+	URL                  string                 `json:"url"`
+	DistributionStrategy string                 `json:"distributionStrategy"`
+	Platforms            []string               `json:"platforms"`
+	Created              time.Time              `json:"created"`
+	Updated              time.Time              `json:"updated"`
+	Metadata             map[string]interface{} `json:"metadata"`
+}
+
+// SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
+func (p *ProductDetails) SetID(id string) error {
+	p.ID = id
+	return nil
+}
+
+// SetType implements the jsonapi.UnmarshalResourceIdentifier interface.
+func (p *ProductDetails) SetType(t string) error {
+	p.Type = t
+	return nil
+}
+
+// SetData implements the jsonapi.UnmarshalData interface.
+func (p *ProductDetails) SetData(to func(target interface{}) error) error {
+	return to(p)
+}
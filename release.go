@@ -28,7 +28,8 @@ type Release struct {
 	Updated     time.Time              `json:"updated"`
 	Metadata    map[string]interface{} `json:"metadata"`
 
-	opts UpgradeOptions `json:"-"`
+	opts   UpgradeOptions `json:"-"`
+	config *Config        `json:"-"`
 }
 
 // SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
@@ -70,7 +71,7 @@ func (r *Release) Install(ctx context.Context) error {
 				return err
 			}
 
-			opts.Verifier = ed25519phVerifier{}
+			opts.Verifier = ed25519phVerifier{Product: r.config.resolve().Product}
 			opts.PublicKey = k
 		}
 	}
@@ -93,7 +94,7 @@ func (r *Release) Install(ctx context.Context) error {
 }
 
 func (r *Release) artifact(ctx context.Context) (*Artifact, error) {
-	client := NewClient()
+	client := r.config.NewClient()
 	artifact := &Artifact{}
 
 	filename, err := r.filename()
@@ -129,11 +130,13 @@ func (r *Release) filename() (string, error) {
 }
 
 // ed25519phVerifier handles verifying the upgrade's signature.
-type ed25519phVerifier struct{}
+type ed25519phVerifier struct {
+	Product string
+}
 
 // VerifySignature verifies the upgrade's signature with Ed25519ph.
 func (v ed25519phVerifier) VerifySignature(checksum []byte, signature []byte, _ crypto.Hash, publicKey crypto.PublicKey) error {
-	opts := &ed25519.Options{Hash: crypto.SHA512, Context: Product}
+	opts := &ed25519.Options{Hash: crypto.SHA512, Context: v.Product}
 	key, err := hex.DecodeString(publicKey.(string))
 	if err != nil {
 		return errors.New("failed to decode ed25519ph public key")
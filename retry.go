@@ -0,0 +1,171 @@
+package keygen
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy defines how failed API requests are automatically retried.
+// Requests are retried on rate limiting errors, and idempotent requests,
+// e.g. reads and validations, are also retried on network errors and
+// server errors. Other requests, e.g. activating a machine, are only
+// retried on network errors when the request never reached the server,
+// since the server may have already handled it. Client errors, e.g. an
+// invalid license, are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a request, including
+	// the first attempt. A value of 0 or 1 disables retries.
+	MaxAttempts int
+
+	// MinBackoff is the base delay used for exponential backoff between
+	// attempts. Defaults to 1 second.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between attempts. Defaults to 30
+	// seconds. A server-provided Retry-After or X-RateLimit-Reset header
+	// will take precedence over exponential backoff, but is still capped
+	// to MaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// attempts returns the maximum number of attempts for a request.
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// retryable reports whether a request should be retried given the result of
+// the previous attempt.
+func (p *RetryPolicy) retryable(req *http.Request, res *Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	// Requests with a body that can't be rewound can't be retried
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	var e *RateLimitError
+	switch {
+	case errors.As(err, &e):
+		return true
+	case res == nil && isDialError(err):
+		// The request never reached the server
+		return true
+	case !idempotent(req):
+		return false
+	case res == nil:
+		// Network error, e.g. a connection reset or timeout
+		return true
+	case res.Status >= http.StatusInternalServerError:
+		return true
+	default:
+		return false
+	}
+}
+
+// idempotentActions are the POST actions that can safely be repeated.
+var idempotentActions = []string{
+	"/actions/validate",
+	"/actions/validate-key",
+	"/actions/check-out",
+	"/actions/ping",
+}
+
+// idempotent reports whether a request can be sent again without side effects,
+// i.e. reads and idempotent actions. Deletions aren't retried, since a retried
+// deletion that already succeeded would fail as not found.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut:
+		return true
+	case http.MethodPost:
+		for _, action := range idempotentActions {
+			if strings.HasSuffix(req.URL.Path, action) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isDialError reports whether a request failed while connecting, before it
+// was sent to the server.
+func isDialError(err error) bool {
+	var e *net.OpError
+
+	return errors.As(err, &e) && e.Op == "dial"
+}
+
+// backoff returns the delay before the next attempt, preferring any delay
+// requested by the server via rate limiting headers.
+func (p *RetryPolicy) backoff(attempt int, res *Response, now time.Time) time.Duration {
+	min := p.MinBackoff
+	if min <= 0 {
+		min = time.Second
+	}
+
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+
+	if res != nil {
+		if i, err := strconv.Atoi(res.Headers.Get("Retry-After")); err == nil && i > 0 {
+			return capBackoff(time.Duration(i)*time.Second, max)
+		}
+
+		if i, err := strconv.ParseInt(res.Headers.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			if d := time.Unix(i, 0).Sub(now); d > 0 {
+				return capBackoff(d, max)
+			}
+		}
+	}
+
+	// Exponential backoff with equal jitter, i.e. wait between half and all
+	// of the computed delay, so concurrent clients don't retry in lockstep.
+	d := min << uint(attempt-1)
+	if d <= 0 || d > max {
+		d = max
+	}
+
+	half := int64(d / 2)
+
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func capBackoff(d time.Duration, max time.Duration) time.Duration {
+	if d > max {
+		return max
+	}
+
+	return d
+}
+
+// rewind returns a copy of the request with a fresh body, so that it can be
+// sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody == nil {
+		return r, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = body
+
+	return r, nil
+}
@@ -0,0 +1,352 @@
+package keygen
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store persists checked out license and machine files, e.g. so that they can
+// be used for offline validation when the API is unreachable. Load methods
+// return ErrStoredFileNotFound when no file has been saved.
+type Store interface {
+	LoadLicenseFile() (*LicenseFile, error)
+	SaveLicenseFile(lic *LicenseFile) error
+	LoadMachineFile() (*MachineFile, error)
+	SaveMachineFile(lic *MachineFile) error
+}
+
+// MemoryStore is a Store that keeps files in memory, e.g. for tests or for
+// long-running processes that don't need to persist files across restarts.
+// The zero value is ready to use.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	licenseFile *LicenseFile
+	machineFile *MachineFile
+	lastSeen    []byte
+}
+
+// LoadLicenseFile implements the Store interface.
+func (s *MemoryStore) LoadLicenseFile() (*LicenseFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.licenseFile == nil {
+		return nil, ErrStoredFileNotFound
+	}
+
+	return s.licenseFile, nil
+}
+
+// SaveLicenseFile implements the Store interface.
+func (s *MemoryStore) SaveLicenseFile(lic *LicenseFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.licenseFile = lic
+
+	return nil
+}
+
+// LoadMachineFile implements the Store interface.
+func (s *MemoryStore) LoadMachineFile() (*MachineFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.machineFile == nil {
+		return nil, ErrStoredFileNotFound
+	}
+
+	return s.machineFile, nil
+}
+
+// SaveMachineFile implements the Store interface.
+func (s *MemoryStore) SaveMachineFile(lic *MachineFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.machineFile = lic
+
+	return nil
+}
+
+// LoadLastSeen implements the LastSeenStore interface.
+func (s *MemoryStore) LoadLastSeen() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.lastSeen == nil {
+		return nil, ErrStoredFileNotFound
+	}
+
+	return s.lastSeen, nil
+}
+
+// SaveLastSeen implements the LastSeenStore interface.
+func (s *MemoryStore) SaveLastSeen(mark []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSeen = mark
+
+	return nil
+}
+
+// FileStore is a Store that persists files to a directory, e.g. so that apps
+// can start offline from the last checkout. Files are written atomically, and
+// include the certificate along with its issued, expiry and TTL attributes.
+type FileStore struct {
+	// Dir is the directory files are stored in. It's created if it doesn't
+	// exist.
+	Dir string
+
+	// LicenseKey, when set, encrypts files at rest using a key derived from
+	// the license key.
+	LicenseKey string
+
+	mu sync.Mutex
+}
+
+type storedFile struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Certificate string    `json:"certificate"`
+	Issued      time.Time `json:"issued"`
+	Expiry      time.Time `json:"expiry"`
+	TTL         int       `json:"ttl"`
+	LicenseID   string    `json:"licenseId,omitempty"`
+	MachineID   string    `json:"machineId,omitempty"`
+}
+
+// LoadLicenseFile implements the Store interface.
+func (s *FileStore) LoadLicenseFile() (*LicenseFile, error) {
+	file, err := s.load("license.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &LicenseFile{
+		ID:          file.ID,
+		Type:        file.Type,
+		Certificate: file.Certificate,
+		Issued:      file.Issued,
+		Expiry:      file.Expiry,
+		TTL:         file.TTL,
+		LicenseID:   file.LicenseID,
+	}, nil
+}
+
+// SaveLicenseFile implements the Store interface.
+func (s *FileStore) SaveLicenseFile(lic *LicenseFile) error {
+	return s.save("license.json", storedFile{
+		ID:          lic.ID,
+		Type:        lic.Type,
+		Certificate: lic.Certificate,
+		Issued:      lic.Issued,
+		Expiry:      lic.Expiry,
+		TTL:         lic.TTL,
+		LicenseID:   lic.LicenseID,
+	})
+}
+
+// LoadMachineFile implements the Store interface.
+func (s *FileStore) LoadMachineFile() (*MachineFile, error) {
+	file, err := s.load("machine.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &MachineFile{
+		ID:          file.ID,
+		Type:        file.Type,
+		Certificate: file.Certificate,
+		Issued:      file.Issued,
+		Expiry:      file.Expiry,
+		TTL:         file.TTL,
+		MachineID:   file.MachineID,
+		LicenseID:   file.LicenseID,
+	}, nil
+}
+
+// SaveMachineFile implements the Store interface.
+func (s *FileStore) SaveMachineFile(lic *MachineFile) error {
+	return s.save("machine.json", storedFile{
+		ID:          lic.ID,
+		Type:        lic.Type,
+		Certificate: lic.Certificate,
+		Issued:      lic.Issued,
+		Expiry:      lic.Expiry,
+		TTL:         lic.TTL,
+		MachineID:   lic.MachineID,
+		LicenseID:   lic.LicenseID,
+	})
+}
+
+// LoadLastSeen implements the LastSeenStore interface.
+func (s *FileStore) LoadLastSeen() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read("last_seen.json")
+}
+
+// SaveLastSeen implements the LastSeenStore interface.
+func (s *FileStore) SaveLastSeen(mark []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write("last_seen.json", mark)
+}
+
+// Clear removes any stored files, e.g. after a license is deactivated. The last
+// seen time is kept, so that clearing files doesn't reset clock-tampering
+// detection.
+func (s *FileStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range []string{"license.json", "machine.json"} {
+		if err := os.Remove(filepath.Join(s.Dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStore) load(name string) (*storedFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *storedFile
+	if err := json.Unmarshal(data, &file); err != nil || file == nil {
+		return nil, ErrStoredFileInvalid
+	}
+
+	return file, nil
+}
+
+func (s *FileStore) save(name string, file storedFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	return s.write(name, data)
+}
+
+// read reads a file, decrypting it when LicenseKey is set.
+func (s *FileStore) read(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, ErrStoredFileNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	if s.LicenseKey != "" {
+		if data, err = s.decrypt(data); err != nil {
+			return nil, ErrStoredFileInvalid
+		}
+	}
+
+	return data, nil
+}
+
+// write writes to a temp file and renames it, so that a crash never leaves a
+// partially written file behind. The file is encrypted when LicenseKey is set.
+func (s *FileStore) write(name string, data []byte) error {
+	var err error
+
+	if s.LicenseKey != "" {
+		if data, err = s.encrypt(data); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+}
+
+func (s *FileStore) aead() (cipher.AEAD, error) {
+	// Use a different key than license files, which are encrypted using a hash
+	// of the license key itself.
+	key := sha256.Sum256([]byte("keygen-store:" + s.LicenseKey))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (s *FileStore) encrypt(plaintext []byte) ([]byte, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (s *FileStore) decrypt(ciphertext []byte) ([]byte, error) {
+	aead, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	n := aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, ErrStoredFileInvalid
+	}
+
+	return aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+}
@@ -53,40 +53,7 @@ type UpgradeOptions struct {
 // Upgrade checks if an upgrade is available for the provided version. Returns a
 // Release and any errors that occurred, e.g. ErrUpgradeNotAvailable.
 func Upgrade(ctx context.Context, options UpgradeOptions) (*Release, error) {
-	if options.PublicKey == PublicKey {
-		panic("You MUST use a personal public key. This MUST NOT be your Keygen account's public key.")
-	}
+	var config *Config // nil uses the package-level globals
 
-	if options.Filename == "" {
-		options.Filename = `{{.program}}_{{.platform}}_{{.arch}}{{if .ext}}.{{.ext}}{{end}}`
-	}
-
-	if options.Product == "" {
-		options.Product = Product
-	}
-
-	if options.Package == "" {
-		options.Package = Package
-	}
-
-	if options.Channel == "" {
-		options.Channel = "stable"
-	}
-
-	client := NewClient()
-	params := querystring{Product: options.Product, Package: options.Package, Constraint: options.Constraint, Channel: options.Channel}
-	release := &Release{}
-
-	if _, err := client.Get(ctx, "releases/"+options.CurrentVersion+"/upgrade", params, release); err != nil {
-		switch err.(type) {
-		case *NotFoundError:
-			return nil, ErrUpgradeNotAvailable
-		default:
-			return nil, err
-		}
-	}
-
-	release.opts = options
-
-	return release, nil
+	return config.Upgrade(ctx, options)
 }
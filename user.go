@@ -0,0 +1,35 @@
+package keygen
+
+import "time"
+
+// User represents a Keygen user object, e.g. a license's owner.
+type User struct {
+	ID        string                 `json:"-"`
+	Type      string                 `json:"-"`
+	FullName  string                 `json:"fullName"`
+	FirstName string                 `json:"firstName"`
+	LastName  string                 `json:"lastName"`
+	Email     string                 `json:"email"`
+	Status    string                 `json:"status"`
+	Role      string                 `json:"role"`
+	Created   time.Time              `json:"created"`
+	Updated   time.Time              `json:"updated"`
+	Metadata  map[string]interface{} `json:"metadata"`
+}
+
+// SetID implements the jsonapi.UnmarshalResourceIdentifier interface.
+func (u *User) SetID(id string) error {
+	u.ID = id
+	return nil
+}
+
+// SetType implements the jsonapi.UnmarshalResourceIdentifier interface.
+func (u *User) SetType(t string) error {
+	u.Type = t
+	return nil
+}
+
+// SetData implements the jsonapi.UnmarshalData interface.
+func (u *User) SetData(to func(target interface{}) error) error {
+	return to(u)
+}
@@ -1,6 +1,11 @@
 package keygen
 
-import "context"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
 
 type ValidationCode string
 
@@ -8,6 +13,7 @@ const (
 	ValidationCodeValid                    ValidationCode = "VALID"
 	ValidationCodeNotFound                 ValidationCode = "NOT_FOUND"
 	ValidationCodeSuspended                ValidationCode = "SUSPENDED"
+	ValidationCodeBanned                   ValidationCode = "BANNED"
 	ValidationCodeExpired                  ValidationCode = "EXPIRED"
 	ValidationCodeOverdue                  ValidationCode = "OVERDUE"
 	ValidationCodeNoMachine                ValidationCode = "NO_MACHINE"
@@ -24,38 +30,133 @@ const (
 	ValidationCodeHeartbeatNotStarted      ValidationCode = "HEARTBEAT_NOT_STARTED"
 	ValidationCodeHeartbeatDead            ValidationCode = "HEARTBEAT_DEAD"
 	ValidationCodeProductScopeRequired     ValidationCode = "PRODUCT_SCOPE_REQUIRED"
-	ValidationCodeProductScopeEmpty        ValidationCode = "PRODUCT_SCOPE_MISMATCH"
+	ValidationCodeProductScopeMismatch     ValidationCode = "PRODUCT_SCOPE_MISMATCH"
 	ValidationCodePolicyScopeRequired      ValidationCode = "POLICY_SCOPE_REQUIRED"
 	ValidationCodePolicyScopeMismatch      ValidationCode = "POLICY_SCOPE_MISMATCH"
 	ValidationCodeMachineScopeRequired     ValidationCode = "MACHINE_SCOPE_REQUIRED"
 	ValidationCodeMachineScopeMismatch     ValidationCode = "MACHINE_SCOPE_MISMATCH"
+	ValidationCodeUserScopeRequired        ValidationCode = "USER_SCOPE_REQUIRED"
+	ValidationCodeUserScopeMismatch        ValidationCode = "USER_SCOPE_MISMATCH"
 	ValidationCodeEntitlementsMissing      ValidationCode = "ENTITLEMENTS_MISSING"
 	ValidationCodeEntitlementsEmpty        ValidationCode = "ENTITLEMENTS_SCOPE_EMPTY"
+
+	// Deprecated: use ValidationCodeProductScopeMismatch.
+	ValidationCodeProductScopeEmpty = ValidationCodeProductScopeMismatch
 )
 
 type validate struct {
-	fingerprint string
-	components  []string
+	key          string
+	fingerprint  string
+	components   []string
+	product      string
+	policy       string
+	machine      string
+	user         string
+	entitlements []EntitlementCode
+	environment  string
+	nonce        int64
+}
+
+// newValidate builds the scope for a validation from the options and any
+// fingerprints (first is machine, rest are components).
+func newValidate(cfg *Config, options ValidationOptions, fingerprints ...string) (validate, error) {
+	params := validate{
+		product:      options.Product,
+		policy:       options.Policy,
+		machine:      options.Machine,
+		user:         options.User,
+		entitlements: options.Entitlements,
+		environment:  cfg.Environment,
+	}
+
+	if params.product == "" {
+		params.product = cfg.Product
+	}
+
+	if n := len(fingerprints); n > 0 {
+		params.fingerprint = fingerprints[0]
+
+		if n > 1 {
+			params.components = fingerprints[1:]
+		}
+	}
+
+	if options.Nonce {
+		// A nonce is only meaningful when the response's signature is verified
+		if cfg.PublicKey == "" {
+			return params, ErrPublicKeyMissing
+		}
+
+		nonce, err := newNonce()
+		if err != nil {
+			return params, err
+		}
+
+		params.nonce = nonce
+	}
+
+	return params, nil
+}
+
+// verify checks that a validation result echoes the validation's nonce, if any.
+func (v validate) verify(result ValidationResult) error {
+	if v.nonce != 0 && result.Nonce != v.nonce {
+		return ErrValidationNonceMismatch
+	}
+
+	return nil
+}
+
+// newNonce returns a random, non-zero nonce. It's limited to 53 bits so that
+// it can be represented exactly as a JSON number.
+func newNonce() (int64, error) {
+	b := make([]byte, 8)
+
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return 0, err
+		}
+
+		if nonce := int64(binary.BigEndian.Uint64(b) >> 11); nonce != 0 {
+			return nonce, nil
+		}
+	}
 }
 
 type meta struct {
-	Scope scope `json:"scope"`
+	Key   string `json:"key,omitempty"`
+	Nonce int64  `json:"nonce,omitempty"`
+	Scope scope  `json:"scope"`
 }
 
 type scope struct {
-	Fingerprint string   `json:"fingerprint,omitempty"`
-	Components  []string `json:"components,omitempty"`
-	Product     string   `json:"product"`
-	Environment *string  `json:"environment,omitempty"`
+	Fingerprint  string            `json:"fingerprint,omitempty"`
+	Components   []string          `json:"components,omitempty"`
+	Product      string            `json:"product"`
+	Policy       string            `json:"policy,omitempty"`
+	Machine      string            `json:"machine,omitempty"`
+	User         string            `json:"user,omitempty"`
+	Entitlements []EntitlementCode `json:"entitlements,omitempty"`
+	Environment  *string           `json:"environment,omitempty"`
 }
 
 // GetMeta implements jsonapi.MarshalMeta interface.
 func (v validate) GetMeta() interface{} {
-	if Environment != "" {
-		return meta{Scope: scope{Fingerprint: v.fingerprint, Components: v.components, Product: Product, Environment: &Environment}}
+	scope := scope{
+		Fingerprint:  v.fingerprint,
+		Components:   v.components,
+		Product:      v.product,
+		Policy:       v.policy,
+		Machine:      v.machine,
+		User:         v.user,
+		Entitlements: v.entitlements,
+	}
+
+	if v.environment != "" {
+		scope.Environment = &v.environment
 	}
 
-	return meta{Scope: scope{Fingerprint: v.fingerprint, Components: v.components, Environment: nil, Product: Product}}
+	return meta{Key: v.key, Nonce: v.nonce, Scope: scope}
 }
 
 type validation struct {
@@ -73,7 +174,7 @@ func (v *validation) SetMeta(to func(target interface{}) error) error {
 	return to(&v.Result)
 }
 
-// ValidationResult contains the scopes for a validation.
+// ValidationScope contains the scopes for a validation.
 type ValidationScope struct {
 	scope
 }
@@ -84,6 +185,13 @@ type ValidationResult struct {
 	Valid  bool             `json:"valid"`
 	Code   ValidationCode   `json:"code"`
 	Scope  *ValidationScope `json:"scope,omitempty"`
+	Nonce  int64            `json:"nonce,omitempty"`
+	Source ValidationSource `json:"-"`
+
+	// Timestamp is the API's time of the validation, from the response's signed
+	// Date header. It's zero when the response's signature wasn't verified, i.e.
+	// without a PublicKey, and for offline validations.
+	Timestamp time.Time `json:"-"`
 }
 
 // Validate performs a license validation using the current Token, scoped to any
@@ -92,16 +200,183 @@ type ValidationResult struct {
 // an error if the license is invalid, e.g. ErrLicenseNotActivated or
 // ErrLicenseExpired.
 func Validate(ctx context.Context, fingerprints ...string) (*License, error) {
-	client := NewClient()
-	license := &License{}
+	var config *Config // nil uses the package-level globals
+
+	return config.Validate(ctx, fingerprints...)
+}
+
+// ValidationOptions contains additional scopes for a validation.
+type ValidationOptions struct {
+	// Product scopes the validation to a product. Defaults to Product.
+	Product string
+
+	// Policy scopes the validation to a policy ID.
+	Policy string
+
+	// Machine scopes the validation to a machine ID.
+	Machine string
+
+	// User scopes the validation to a user ID or email.
+	User string
+
+	// Entitlements scopes the validation to licenses having all of the given
+	// entitlements.
+	Entitlements []EntitlementCode
+
+	// Nonce, when true, sends a random nonce that the API's signed response must
+	// echo back, so that an old response can't be replayed. It returns
+	// ErrValidationNonceMismatch when the nonce doesn't match. Requires that
+	// PublicKey is set, so that the response's signature is verified.
+	Nonce bool
+}
+
+// ValidateWithOptions performs a license validation using the current Token, scoped
+// to any provided fingerprints and options. See Validate.
+func ValidateWithOptions(ctx context.Context, options ValidationOptions, fingerprints ...string) (*License, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.ValidateWithOptions(ctx, options, fingerprints...)
+}
+
+// ValidateKey performs a license validation using the current LicenseKey, scoped
+// to any provided fingerprints and options. Unlike Validate, the request isn't
+// authenticated, so it can be used for policies where license authentication
+// is disabled. It returns a License, and an error if the license is invalid,
+// e.g. ErrLicenseNotActivated or ErrLicenseExpired. When the key doesn't match
+// a license, a nil License and ErrLicenseInvalid are returned.
+func ValidateKey(ctx context.Context, options ValidationOptions, fingerprints ...string) (*License, error) {
+	var config *Config // nil uses the package-level globals
+
+	return config.ValidateKey(ctx, options, fingerprints...)
+}
+
+// Err returns the validation code's specific error, or nil if valid, e.g.
+// ErrFingerprintNotActivated for FINGERPRINT_SCOPE_MISMATCH. Codes that share
+// a more general error wrap it, e.g. ErrLicenseNotActivated, and can be checked
+// using errors.Is. Validations return the general errors, for compatibility.
+func (r *ValidationResult) Err() error {
+	if r == nil {
+		return nil
+	}
+
+	return validationCodeError(r.Code)
+}
+
+// validationError maps a validation code to the error returned by validations,
+// or nil if valid. These are the general errors that validations have always
+// returned, so that e.g. err == ErrLicenseNotActivated keeps working. See
+// ValidationResult.Err for the code's specific error.
+func validationError(code ValidationCode) error {
+	switch code {
+	case ValidationCodeValid:
+		return nil
+	case ValidationCodeFingerprintScopeMismatch, ValidationCodeNoMachines, ValidationCodeNoMachine:
+		return ErrLicenseNotActivated
+	case ValidationCodeExpired:
+		return ErrLicenseExpired
+	case ValidationCodeSuspended:
+		return ErrLicenseSuspended
+	case ValidationCodeTooManyMachines:
+		return ErrLicenseTooManyMachines
+	case ValidationCodeTooManyCores:
+		return ErrLicenseTooManyCores
+	case ValidationCodeTooManyProcesses:
+		return ErrLicenseTooManyProcesses
+	case ValidationCodeFingerprintScopeRequired, ValidationCodeFingerprintScopeEmpty:
+		return ErrValidationFingerprintMissing
+	case ValidationCodeComponentsScopeRequired, ValidationCodeComponentsScopeEmpty:
+		return ErrValidationComponentsMissing
+	case ValidationCodeComponentsScopeMismatch:
+		return ErrComponentNotActivated
+	case ValidationCodeHeartbeatNotStarted:
+		return ErrHeartbeatRequired
+	case ValidationCodeHeartbeatDead:
+		return ErrHeartbeatDead
+	case ValidationCodeProductScopeRequired, ValidationCodeProductScopeMismatch:
+		return ErrValidationProductMissing
+	default:
+		return ErrLicenseInvalid
+	}
+}
+
+// validationCodeError maps a validation code to its specific error, or nil if
+// valid.
+func validationCodeError(code ValidationCode) error {
+	switch code {
+	case ValidationCodeValid:
+		return nil
+	case ValidationCodeNotFound:
+		return ErrLicenseNotFound
+	case ValidationCodeSuspended:
+		return ErrLicenseSuspended
+	case ValidationCodeBanned:
+		return ErrLicenseBanned
+	case ValidationCodeExpired:
+		return ErrLicenseExpired
+	case ValidationCodeOverdue:
+		return ErrLicenseOverdue
+	case ValidationCodeNoMachine:
+		return ErrLicenseNotActivated
+	case ValidationCodeNoMachines:
+		return ErrLicenseNoMachines
+	case ValidationCodeTooManyMachines:
+		return ErrLicenseTooManyMachines
+	case ValidationCodeTooManyCores:
+		return ErrLicenseTooManyCores
+	case ValidationCodeTooManyProcesses:
+		return ErrLicenseTooManyProcesses
+	case ValidationCodeFingerprintScopeRequired:
+		return ErrValidationFingerprintMissing
+	case ValidationCodeFingerprintScopeMismatch:
+		return ErrFingerprintNotActivated
+	case ValidationCodeFingerprintScopeEmpty:
+		return ErrValidationFingerprintEmpty
+	case ValidationCodeComponentsScopeRequired:
+		return ErrValidationComponentsMissing
+	case ValidationCodeComponentsScopeMismatch:
+		return ErrComponentNotActivated
+	case ValidationCodeComponentsScopeEmpty:
+		return ErrValidationComponentsEmpty
+	case ValidationCodeHeartbeatNotStarted:
+		return ErrHeartbeatRequired
+	case ValidationCodeHeartbeatDead:
+		return ErrHeartbeatDead
+	case ValidationCodeProductScopeRequired:
+		return ErrValidationProductMissing
+	case ValidationCodeProductScopeMismatch:
+		return ErrValidationProductMismatch
+	case ValidationCodePolicyScopeRequired:
+		return ErrValidationPolicyMissing
+	case ValidationCodePolicyScopeMismatch:
+		return ErrValidationPolicyMismatch
+	case ValidationCodeMachineScopeRequired:
+		return ErrValidationMachineMissing
+	case ValidationCodeMachineScopeMismatch:
+		return ErrValidationMachineMismatch
+	case ValidationCodeUserScopeRequired:
+		return ErrValidationUserMissing
+	case ValidationCodeUserScopeMismatch:
+		return ErrValidationUserMismatch
+	case ValidationCodeEntitlementsMissing:
+		return ErrLicenseEntitlementsMissing
+	case ValidationCodeEntitlementsEmpty:
+		return ErrValidationEntitlementsEmpty
+	default:
+		return ErrLicenseInvalid
+	}
+}
 
-	if _, err := client.Get(ctx, "me", nil, license); err != nil {
-		return nil, err
+// signedDate returns the time of a response from its Date header, when the
+// response's signature was verified by the client. It's zero otherwise.
+func signedDate(client *Client, res *Response) time.Time {
+	if client.PublicKey == "" || res == nil {
+		return time.Time{}
 	}
 
-	if err := license.Validate(ctx, fingerprints...); err != nil {
-		return license, err
+	t, err := time.Parse(time.RFC1123, res.Headers.Get("Date"))
+	if err != nil {
+		return time.Time{}
 	}
 
-	return license, nil
+	return t
 }
@@ -2,10 +2,15 @@ package keygen
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,7 +19,9 @@ import (
 )
 
 type verifier struct {
-	PublicKey string
+	PublicKey    string
+	RSAPublicKey string
+	Clock        Clock
 }
 
 // VerifyLicenseFile checks if a license file is genuine.
@@ -41,6 +48,23 @@ func (v *verifier) VerifyLicenseFile(lic *LicenseFile) error {
 			return ErrLicenseFileNotGenuine
 		}
 
+		return nil
+	case isRSAAlgorithm(cert.Alg):
+		publicKey, err := v.rsaPublicKey()
+		if err != nil {
+			return err
+		}
+
+		msg := []byte("license/" + cert.Enc)
+		sig, err := base64.StdEncoding.DecodeString(cert.Sig)
+		if err != nil {
+			return ErrLicenseFileNotGenuine
+		}
+
+		if err := verifyRSA(publicKey, isPSSAlgorithm(cert.Alg), msg, sig); err != nil {
+			return ErrLicenseFileNotGenuine
+		}
+
 		return nil
 	default:
 		return ErrLicenseFileNotSupported
@@ -71,6 +95,23 @@ func (v *verifier) VerifyMachineFile(lic *MachineFile) error {
 			return ErrMachineFileNotGenuine
 		}
 
+		return nil
+	case isRSAAlgorithm(cert.Alg):
+		publicKey, err := v.rsaPublicKey()
+		if err != nil {
+			return err
+		}
+
+		msg := []byte("machine/" + cert.Enc)
+		sig, err := base64.StdEncoding.DecodeString(cert.Sig)
+		if err != nil {
+			return ErrMachineFileNotGenuine
+		}
+
+		if err := verifyRSA(publicKey, isPSSAlgorithm(cert.Alg), msg, sig); err != nil {
+			return ErrMachineFileNotGenuine
+		}
+
 		return nil
 	default:
 		return ErrMachineFileNotSupported
@@ -94,6 +135,14 @@ func (v *verifier) VerifyLicense(license *License) ([]byte, error) {
 	case license.Scheme == SchemeCodeEd25519:
 		dataset, err := v.verifyKey(license.Key)
 
+		return dataset, err
+	case license.Scheme == SchemeCodeRSA2048PKCS1SignV2 || license.Scheme == SchemeCodeRSA2048PKCS1PSSSignV2:
+		dataset, err := v.verifyRSAKey(license.Key, license.Scheme == SchemeCodeRSA2048PKCS1PSSSignV2)
+
+		return dataset, err
+	case license.Scheme == SchemeCodeRSA2048JWTRS256:
+		dataset, err := v.verifyJWTKey(license.Key)
+
 		return dataset, err
 	default:
 		return nil, ErrLicenseSchemeNotSupported
@@ -136,7 +185,7 @@ func (v *verifier) VerifyRequest(request *http.Request) error {
 		return err
 	}
 
-	if MaxClockDrift >= 0 && time.Since(t) > MaxClockDrift {
+	if MaxClockDrift >= 0 && v.now().Sub(t) > MaxClockDrift {
 		return ErrRequestDateTooOld
 	}
 
@@ -208,7 +257,7 @@ func (v *verifier) VerifyResponse(response *Response) error {
 		return err
 	}
 
-	if MaxClockDrift >= 0 && time.Since(t) > MaxClockDrift {
+	if MaxClockDrift >= 0 && v.now().Sub(t) > MaxClockDrift {
 		return ErrResponseDateTooOld
 	}
 
@@ -259,36 +308,113 @@ func (v *verifier) verifyKey(key string) ([]byte, error) {
 		return nil, err
 	}
 
-	parts := strings.SplitN(key, ".", 2)
-	signingData := parts[0]
-	encSig := parts[1]
+	msg, sig, dataset, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok := ed25519.Verify(publicKey, msg, sig); !ok {
+		return nil, ErrLicenseKeyNotGenuine
+	}
+
+	return dataset, nil
+}
+
+func (v *verifier) verifyRSAKey(key string, pss bool) ([]byte, error) {
+	publicKey, err := v.rsaPublicKey()
+	if err != nil {
+		return nil, err
+	}
 
-	parts = strings.SplitN(signingData, "/", 2)
-	signingPrefix := parts[0]
-	encDataset := parts[1]
+	msg, sig, dataset, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
 
-	if signingPrefix != "key" {
+	if err := verifyRSA(publicKey, pss, msg, sig); err != nil {
 		return nil, ErrLicenseKeyNotGenuine
 	}
 
-	msg := []byte("key/" + encDataset)
-	sig, err := base64.URLEncoding.DecodeString(encSig)
+	return dataset, nil
+}
+
+func (v *verifier) verifyJWTKey(key string) ([]byte, error) {
+	publicKey, err := v.rsaPublicKey()
 	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 {
 		return nil, ErrLicenseKeyNotGenuine
 	}
 
-	dataset, err := base64.URLEncoding.DecodeString(encDataset)
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
 	if err != nil {
 		return nil, ErrLicenseKeyNotGenuine
 	}
 
-	if ok := ed25519.Verify(publicKey, msg, sig); !ok {
+	var jwt struct {
+		Alg string `json:"alg"`
+	}
+
+	if err := json.Unmarshal(header, &jwt); err != nil || jwt.Alg != "RS256" {
+		return nil, ErrLicenseKeyNotGenuine
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrLicenseKeyNotGenuine
+	}
+
+	dataset, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrLicenseKeyNotGenuine
+	}
+
+	if err := verifyRSA(publicKey, false, []byte(parts[0]+"."+parts[1]), sig); err != nil {
 		return nil, ErrLicenseKeyNotGenuine
 	}
 
 	return dataset, nil
 }
 
+// splitKey splits a signed key, in the format key/{dataset}.{signature}, into
+// its signed message, signature and decoded dataset.
+func splitKey(key string) ([]byte, []byte, []byte, error) {
+	signingData, encSig, ok := cut(key, ".")
+	if !ok {
+		return nil, nil, nil, ErrLicenseKeyNotGenuine
+	}
+
+	signingPrefix, encDataset, ok := cut(signingData, "/")
+	if !ok || signingPrefix != "key" || encDataset == "" || encSig == "" {
+		return nil, nil, nil, ErrLicenseKeyNotGenuine
+	}
+
+	msg := []byte("key/" + encDataset)
+	sig, err := base64.URLEncoding.DecodeString(encSig)
+	if err != nil {
+		return nil, nil, nil, ErrLicenseKeyNotGenuine
+	}
+
+	dataset, err := base64.URLEncoding.DecodeString(encDataset)
+	if err != nil {
+		return nil, nil, nil, ErrLicenseKeyNotGenuine
+	}
+
+	return msg, sig, dataset, nil
+}
+
+// cut slices s around the first instance of sep, like strings.Cut.
+func cut(s string, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
+
 func (v *verifier) publicKeyBytes() ([]byte, error) {
 	if v.PublicKey == "" {
 		return nil, ErrPublicKeyMissing
@@ -319,3 +445,59 @@ func parseSignatureHeader(header string) map[string]string {
 
 	return params
 }
+
+func (v *verifier) rsaPublicKey() (*rsa.PublicKey, error) {
+	if v.RSAPublicKey == "" {
+		return nil, ErrPublicKeyMissing
+	}
+
+	block, _ := pem.Decode([]byte(v.RSAPublicKey))
+	if block == nil {
+		return nil, ErrPublicKeyInvalid
+	}
+
+	// Support both PKIX and PKCS#1 encoded public keys
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, ErrPublicKeyInvalid
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrPublicKeyInvalid
+	}
+
+	return publicKey, nil
+}
+
+// verifyRSA verifies a SHA-256 RSA signature, using either PSS or PKCS#1 v1.5.
+func verifyRSA(publicKey *rsa.PublicKey, pss bool, msg []byte, sig []byte) error {
+	digest := sha256.Sum256(msg)
+
+	if pss {
+		return rsa.VerifyPSS(publicKey, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	}
+
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig)
+}
+
+func isRSAAlgorithm(alg string) bool {
+	return strings.HasSuffix(alg, "+rsa-sha256") || isPSSAlgorithm(alg)
+}
+
+func isPSSAlgorithm(alg string) bool {
+	return strings.HasSuffix(alg, "+rsa-pss-sha256")
+}
+
+// now returns the current time using the verifier's clock, or the DefaultClock.
+func (v *verifier) now() time.Time {
+	if v.Clock != nil {
+		return v.Clock.Now()
+	}
+
+	return defaultClock().Now()
+}
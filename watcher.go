@@ -0,0 +1,284 @@
+package keygen
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWatchInterval is the default time between a Watcher's validations.
+	DefaultWatchInterval = time.Hour
+
+	watchMinBackoff = 5 * time.Second
+)
+
+// WatchOptions contains the options for a license watcher.
+type WatchOptions struct {
+	// Interval is the time between validations. Defaults to DefaultWatchInterval.
+	Interval time.Duration
+
+	// Jitter is the maximum random delay added to each interval, so that many
+	// clients don't revalidate in lockstep. Defaults to a tenth of the interval.
+	// A negative jitter disables it.
+	Jitter time.Duration
+
+	// ValidationOptions are used for each validation, e.g. to scope it to a
+	// policy or to require entitlements.
+	ValidationOptions ValidationOptions
+}
+
+// ValidationChange is emitted by a Watcher when a license's validation code
+// changes, e.g. from VALID to EXPIRED.
+type ValidationChange struct {
+	// From is the previous validation code, or empty for the first validation
+	// of a license that hadn't been validated.
+	From ValidationCode
+
+	// To is the new validation code.
+	To ValidationCode
+
+	// License is the license as of the validation.
+	License *License
+
+	// Err is the validation's error, e.g. ErrLicenseExpired, or nil if valid.
+	Err error
+}
+
+// Watcher revalidates a license on a loop, until its context is cancelled, and
+// reports changes to the license's validation code. Failed validations, e.g.
+// due to network errors, are retried with backoff. A Watcher is safe for
+// concurrent use by multiple goroutines.
+type Watcher struct {
+	license      *License
+	options      WatchOptions
+	fingerprints []string
+	changes      chan ValidationChange
+	errs         chan error
+	done         chan struct{}
+	mu           sync.RWMutex
+	callbacks    []func(ValidationChange)
+	latest       *License
+	code         ValidationCode
+	err          error
+}
+
+// Watch starts a Watcher which revalidates the license every interval, scoped
+// to any provided fingerprints, until the context is cancelled. The license
+// itself isn't modified: use Watcher.License for the latest copy. Its cached
+// entitlements are shared with the watcher, so they're refreshed on each
+// revalidation, like with ValidateWithOptions.
+//
+// Example:
+//
+//	watcher := license.Watch(ctx, keygen.WatchOptions{Interval: 15 * time.Minute}, fingerprint)
+//
+//	watcher.OnChange(func(change keygen.ValidationChange) {
+//		switch change.To {
+//		case keygen.ValidationCodeExpired, keygen.ValidationCodeSuspended:
+//			showLicenseDialog(change.License)
+//		}
+//	})
+func (l *License) Watch(ctx context.Context, options WatchOptions, fingerprints ...string) *Watcher {
+	if options.Interval <= 0 {
+		options.Interval = DefaultWatchInterval
+	}
+
+	switch {
+	case options.Jitter == 0:
+		options.Jitter = options.Interval / 10
+	case options.Jitter < 0:
+		options.Jitter = 0
+	}
+
+	// Initialize the entitlement cache before copying, so that the watcher's
+	// license and its copies share it
+	l.entitlementCache()
+
+	latest := *l
+	w := &Watcher{
+		license:      &License{ID: l.ID, config: l.config, entitlements: l.entitlements},
+		options:      options,
+		fingerprints: fingerprints,
+		changes:      make(chan ValidationChange, 16),
+		errs:         make(chan error, 16),
+		done:         make(chan struct{}),
+		latest:       &latest,
+	}
+
+	if l.LastValidation != nil {
+		w.code = l.LastValidation.Code
+	}
+
+	go w.run(ctx)
+
+	return w
+}
+
+// OnChange registers a callback which is called with each change to the
+// license's validation code. Callbacks are called in order, from the
+// watcher's goroutine, so they should not block.
+func (w *Watcher) OnChange(fn func(change ValidationChange)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.callbacks = append(w.callbacks, fn)
+}
+
+// Changes returns a channel where changes to the license's validation code are
+// emitted. Changes are dropped when the channel's buffer is full. The channel
+// is closed once the watcher stops.
+func (w *Watcher) Changes() <-chan ValidationChange {
+	return w.changes
+}
+
+// Errors returns a channel where failed validations are emitted, e.g. network
+// errors. Errors are dropped when the channel's buffer is full. The channel is
+// closed once the watcher stops.
+func (w *Watcher) Errors() <-chan error {
+	return w.errs
+}
+
+// Done returns a channel that's closed once the watcher stops.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// Err returns the context's error once the watcher stops. Returns nil while
+// the watcher is running.
+func (w *Watcher) Err() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.err
+}
+
+// License returns a copy of the license as of its latest validation.
+func (w *Watcher) License() *License {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.latest
+}
+
+// Code returns the license's latest validation code, or empty if the license
+// hasn't been validated yet.
+func (w *Watcher) Code() ValidationCode {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.code
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	var backoff time.Duration
+
+	timer := w.license.config.clock().NewTimer(w.delay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.stop(ctx.Err())
+
+			return
+		case <-timer.C():
+		}
+
+		err := w.validate(ctx)
+		switch {
+		case ctx.Err() != nil:
+			w.stop(ctx.Err())
+
+			return
+		case err != nil:
+			Logger.Warnf("License validation failed: license_id=%s err=%v", w.license.ID, err)
+
+			w.emit(err)
+
+			// Retry sooner than the interval, backing off up to the interval
+			if backoff *= 2; backoff == 0 {
+				backoff = watchMinBackoff
+			}
+
+			if backoff > w.options.Interval {
+				backoff = w.options.Interval
+			}
+
+			timer.Reset(backoff)
+		default:
+			backoff = 0
+
+			timer.Reset(w.delay())
+		}
+	}
+}
+
+// validate revalidates the license, reporting any change to its validation code.
+// It only returns an error when there's no validation result, e.g. due to a
+// network error.
+func (w *Watcher) validate(ctx context.Context) error {
+	w.license.LastValidation = nil
+
+	err := w.license.ValidateWithOptions(ctx, w.options.ValidationOptions, w.fingerprints...)
+
+	result := w.license.LastValidation
+	if result == nil {
+		return err
+	}
+
+	license := *w.license
+
+	w.mu.Lock()
+	from := w.code
+	w.code = result.Code
+	w.latest = &license
+	callbacks := w.callbacks
+	w.mu.Unlock()
+
+	if from == result.Code {
+		return nil
+	}
+
+	change := ValidationChange{From: from, To: result.Code, License: &license, Err: err}
+
+	select {
+	case w.changes <- change:
+	default:
+		Logger.Warnf("License validation change dropped: license_id=%s from=%s to=%s", license.ID, from, result.Code)
+	}
+
+	for _, fn := range callbacks {
+		fn(change)
+	}
+
+	return nil
+}
+
+// delay returns the interval plus a random jitter.
+func (w *Watcher) delay() time.Duration {
+	if w.options.Jitter <= 0 {
+		return w.options.Interval
+	}
+
+	return w.options.Interval + time.Duration(rand.Int63n(int64(w.options.Jitter)))
+}
+
+func (w *Watcher) emit(err error) {
+	select {
+	case w.errs <- err:
+	default:
+		Logger.Warnf("License validation error dropped: err=%v", err)
+	}
+}
+
+func (w *Watcher) stop(err error) {
+	w.mu.Lock()
+	w.err = err
+	w.mu.Unlock()
+
+	close(w.changes)
+	close(w.errs)
+	close(w.done)
+}
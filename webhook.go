@@ -24,7 +24,7 @@ import (
 //		http.ListenAndServe(":8081", nil)
 //	}
 func VerifyWebhook(request *http.Request) error {
-	verifier := &verifier{PublicKey: PublicKey}
+	var config *Config // nil uses the package-level globals
 
-	return verifier.VerifyRequest(request)
+	return config.VerifyWebhook(request)
 }